@@ -0,0 +1,146 @@
+package ast
+
+// ModifierFunc receives a node and returns the node that should take its place
+type ModifierFunc func(Node) Node
+
+// Modify walks the tree depth-first, replacing children before their parents.
+// It is used to splice unquoted values into quoted code and to expand macro calls.
+// The tree is not changed, nodes with children are copied instead,
+// so the body of a macro stays intact and expands differently on every call
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		copied := *n
+		copied.Statements = make([]Statement, len(n.Statements))
+		for i, statement := range n.Statements {
+			copied.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+		node = &copied
+	case *ExpressionStatement:
+		copied := *n
+		copied.Expression, _ = Modify(n.Expression, modifier).(Expression)
+		node = &copied
+	case *InfixExpression:
+		copied := *n
+		copied.Left, _ = Modify(n.Left, modifier).(Expression)
+		copied.Right, _ = Modify(n.Right, modifier).(Expression)
+		node = &copied
+	case *TemplateLiteral:
+		copied := *n
+		copied.Expressions = modifyExpressions(n.Expressions, modifier)
+		node = &copied
+	case *PrefixExpression:
+		copied := *n
+		copied.Right, _ = Modify(n.Right, modifier).(Expression)
+		node = &copied
+	case *IndexExpression:
+		copied := *n
+		copied.Left, _ = Modify(n.Left, modifier).(Expression)
+		copied.Index, _ = Modify(n.Index, modifier).(Expression)
+		node = &copied
+	case *SliceExpression:
+		copied := *n
+		copied.Left, _ = Modify(n.Left, modifier).(Expression)
+		if n.Start != nil {
+			copied.Start, _ = Modify(n.Start, modifier).(Expression)
+		}
+		if n.End != nil {
+			copied.End, _ = Modify(n.End, modifier).(Expression)
+		}
+		node = &copied
+	case *ConditionalExpression:
+		copied := *n
+		copied.Condition, _ = Modify(n.Condition, modifier).(Expression)
+		copied.Consequence, _ = Modify(n.Consequence, modifier).(Expression)
+		copied.Alternative, _ = Modify(n.Alternative, modifier).(Expression)
+		node = &copied
+	case *AssignExpression:
+		copied := *n
+		copied.Target, _ = Modify(n.Target, modifier).(Expression)
+		copied.Value, _ = Modify(n.Value, modifier).(Expression)
+		node = &copied
+	case *IfExpression:
+		copied := *n
+		copied.Condition, _ = Modify(n.Condition, modifier).(Expression)
+		copied.Consequence, _ = Modify(n.Consequence, modifier).(*BlockStatement)
+		if n.Alternative != nil {
+			copied.Alternative, _ = Modify(n.Alternative, modifier).(*BlockStatement)
+		}
+		node = &copied
+	case *BlockStatement:
+		copied := *n
+		copied.Statements = make([]Statement, len(n.Statements))
+		for i, statement := range n.Statements {
+			copied.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+		node = &copied
+	case *ReturnStatement:
+		copied := *n
+		copied.ReturnValue, _ = Modify(n.ReturnValue, modifier).(Expression)
+		node = &copied
+	case *WhileStatement:
+		copied := *n
+		copied.Condition, _ = Modify(n.Condition, modifier).(Expression)
+		copied.Body, _ = Modify(n.Body, modifier).(*BlockStatement)
+		node = &copied
+	case *ForStatement:
+		copied := *n
+		copied.Iterable, _ = Modify(n.Iterable, modifier).(Expression)
+		copied.Body, _ = Modify(n.Body, modifier).(*BlockStatement)
+		node = &copied
+	case *ThrowStatement:
+		copied := *n
+		copied.Value, _ = Modify(n.Value, modifier).(Expression)
+		node = &copied
+	case *TryExpression:
+		copied := *n
+		copied.Block, _ = Modify(n.Block, modifier).(*BlockStatement)
+		if n.Catch != nil {
+			copied.Catch, _ = Modify(n.Catch, modifier).(*BlockStatement)
+		}
+		if n.Finally != nil {
+			copied.Finally, _ = Modify(n.Finally, modifier).(*BlockStatement)
+		}
+		node = &copied
+	case *LetStatement:
+		copied := *n
+		copied.Value, _ = Modify(n.Value, modifier).(Expression)
+		node = &copied
+	case *FunctionLiteral:
+		copied := *n
+		copied.Parameters = make([]*Identifier, len(n.Parameters))
+		for i, param := range n.Parameters {
+			copied.Parameters[i], _ = Modify(param, modifier).(*Identifier)
+		}
+		copied.Body, _ = Modify(n.Body, modifier).(*BlockStatement)
+		node = &copied
+	case *CallExpression:
+		copied := *n
+		copied.Function, _ = Modify(n.Function, modifier).(Expression)
+		copied.Arguments = modifyExpressions(n.Arguments, modifier)
+		node = &copied
+	case *ArrayLiteral:
+		copied := *n
+		copied.Elements = modifyExpressions(n.Elements, modifier)
+		node = &copied
+	case *HashLiteral:
+		copied := *n
+		copied.Pairs = make([]HashPair, len(n.Pairs))
+		for i, pair := range n.Pairs {
+			copied.Pairs[i].Key, _ = Modify(pair.Key, modifier).(Expression)
+			copied.Pairs[i].Value, _ = Modify(pair.Value, modifier).(Expression)
+		}
+		node = &copied
+	}
+
+	return modifier(node)
+}
+
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) []Expression {
+	modified := make([]Expression, len(expressions))
+	for i, exp := range expressions {
+		modified[i], _ = Modify(exp, modifier).(Expression)
+	}
+
+	return modified
+}
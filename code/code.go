@@ -0,0 +1,275 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a flat sequence of bytecode instructions.
+// Every instruction is an opcode byte followed by its operands encoded in big endian
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push constant from the constant pool
+
+	OpPop // pop the topmost element of the stack
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterEqual
+	OpLessEqual
+	OpIn
+
+	OpMinus
+	OpBang
+
+	OpJumpNotTruthy
+	OpJump
+	OpJumpNotTruthyOrPop // jump if the value on top of the stack is not truthy, pop it otherwise, used by &&
+	OpJumpTruthyOrPop    // jump if the value on top of the stack is truthy, pop it otherwise, used by ||
+	OpJumpNotNullOrPop   // jump if the value on top of the stack is not null, pop it otherwise, used by ??
+	OpJumpNull           // jump if the value on top of the stack is null, it stays on the stack either way, used by ?.
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpSetFree
+	OpCurrentClosure // push the closure that is currently executed, used for recursion
+	OpGetLocalCell   // push the cell of the local variable, so a closure can capture it
+	OpGetFreeCell    // push the cell of the free variable, so a nested closure can capture it
+
+	OpArray
+	OpHash
+	OpConcat // replace the values on top of the stack with the concatenation of their strings, used by "${}"
+	OpIndex
+	OpSetIndex // store the value in the array or the hash, the value stays on the stack
+	OpDupPair  // duplicate the two topmost elements of the stack
+	OpSlice    // replace the value and both bounds of the slice with the slice, a null bound is omitted
+
+	OpIterator // replace the value on top of the stack with an iterator over it
+	OpIterNext // push the next element(s) of the iterator or jump if there are none left
+
+	OpSetupTry // register the handler the vm jumps to if an instruction fails before the matching OpPopTry
+	OpPopTry   // remove the innermost handler of the frame
+	OpThrow    // raise the value on top of the stack as an error
+	OpRethrow  // raise the error caught by the finally handler again, once the finally block is done
+
+	OpCall
+	OpReturnValue // return the value on top of the stack
+	OpReturn      // return from a function without value, i.e. return null
+
+	OpClosure
+
+	OpQuote // replace the values of the unquote calls on top of the stack with the quoted code they are spliced into
+	OpError // raise the error with the message from the constant pool, the evaluator reports it only once the code runs
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // number of bytes each operand takes up
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+
+	OpPop: {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpIn:           {"OpIn", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy:      {"OpJumpNotTruthy", []int{2}},
+	OpJump:               {"OpJump", []int{2}},
+	OpJumpNotTruthyOrPop: {"OpJumpNotTruthyOrPop", []int{2}},
+	OpJumpTruthyOrPop:    {"OpJumpTruthyOrPop", []int{2}},
+	OpJumpNotNullOrPop:   {"OpJumpNotNullOrPop", []int{2}},
+	OpJumpNull:           {"OpJumpNull", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpGetLocalCell:   {"OpGetLocalCell", []int{1}},
+	OpGetFreeCell:    {"OpGetFreeCell", []int{1}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpConcat:   {"OpConcat", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+	OpDupPair:  {"OpDupPair", []int{}},
+	OpSlice:    {"OpSlice", []int{}},
+
+	OpIterator: {"OpIterator", []int{}},
+	// first operand is the jump target once the iterator is exhausted,
+	// second one is the number of loop variables, i.e. how many values are pushed
+	OpIterNext: {"OpIterNext", []int{2, 1}},
+
+	// first operand is the position of the handler, second one is 1 for finally and 0 for catch.
+	// Catch gets the error as a hash, finally gets the error itself to raise it again
+	OpSetupTry: {"OpSetupTry", []int{2, 1}},
+	OpPopTry:   {"OpPopTry", []int{}},
+	OpThrow:    {"OpThrow", []int{}},
+	OpRethrow:  {"OpRethrow", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	// first operand is the constant index of the *object.CompiledFunction,
+	// second one is the number of free variables on the stack
+	OpClosure: {"OpClosure", []int{2, 1}},
+
+	// first operand is the constant index of the *object.Quote with the quoted code,
+	// second one is the number of values on the stack
+	OpQuote: {"OpQuote", []int{2, 2}},
+	OpError: {"OpError", []int{2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes opcode and its operands into a single instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands is the counterpart of Make.
+// It decodes operands of the instruction and returns them with the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
@@ -0,0 +1,1044 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/titivuk/go-interpreter/ast"
+	"github.com/titivuk/go-interpreter/code"
+	"github.com/titivuk/go-interpreter/object"
+	"github.com/titivuk/go-interpreter/token"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds instructions of a single function body (or the main program).
+// Every function literal opens a new scope, so its instructions do not get mixed with the outer ones
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	positions           map[int]token.Position // source position of every emitted instruction
+	loops               []*loop                // loops being compiled, the innermost one is the last
+	tries               []*tryBlock            // try expressions being compiled, the innermost one is the last
+}
+
+// loop collects jumps of break and continue statements of a single loop
+type loop struct {
+	continuePos int   // where continue jumps to
+	breaks      []int // positions of break jumps, patched once the end of the loop is known
+	tries       int   // number of try expressions the loop is inside of, break and continue leave the rest
+}
+
+// tryBlock is a try expression being compiled. Break, continue and return that jump out of it
+// have to remove its handlers and run its finally block on the way
+type tryBlock struct {
+	handlers int                 // handlers of the try expression that are active where the jump is
+	finally  *ast.BlockStatement // nil if there is no finally block
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	currentPos token.Position // position of the node that is being compiled
+}
+
+// Bytecode is the result of the compilation, the vm runs it
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    map[int]token.Position
+	Constants    []object.Object
+	Globals      []string // names of the globals by index, the vm reports a global read before it is defined
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+		positions:           make(map[int]token.Position),
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// NewWithState creates compiler that keeps globals and constants between compilations,
+// the REPL uses it to compile every input line against the same state
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	// instructions emitted for the node point at the node in the source,
+	// the vm uses it to report position of runtime errors
+	outerPos := c.currentPos
+	c.currentPos = node.Pos()
+	defer func() { c.currentPos = outerPos }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+
+		// expression statements produce a value that nobody uses, so we clean up the stack
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		if c.symbolTable.IsConst(node.Name.Value) {
+			c.emitError(fmt.Sprintf("cannot redeclare constant %s", node.Name.Value))
+			return nil
+		}
+
+		define := func() Symbol {
+			if node.IsConst() {
+				return c.symbolTable.DefineConst(node.Name.Value)
+			}
+			return c.symbolTable.Define(node.Name.Value)
+		}
+
+		// the body of the function may assign to the binding the function is stored in
+		var symbol Symbol
+		fn, named := node.Value.(*ast.FunctionLiteral)
+		named = named && fn.Name == node.Name.Value
+		if named {
+			symbol = define()
+		}
+
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if !named {
+			symbol = define()
+		}
+		c.storeSymbol(symbol)
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		err = c.leaveTries(0)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+	case *ast.Identifier:
+		c.loadSymbol(c.resolve(node.Value))
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = object.NewInteger(node.Big)
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.TemplateLiteral:
+		count := 0
+
+		for i, str := range node.Strings {
+			// empty strings do not change the result, e.g. the one before "${x}"
+			if str != "" {
+				c.emit(code.OpConstant, c.addConstant(&object.String{Value: str}))
+				count++
+			}
+
+			if i < len(node.Expressions) {
+				err := c.Compile(node.Expressions[i])
+				if err != nil {
+					return err
+				}
+				count++
+			}
+		}
+
+		c.emit(code.OpConcat, count)
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case token.BANG:
+			c.emit(code.OpBang)
+		case token.MINUS:
+			c.emit(code.OpMinus)
+		default:
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		if jump, ok := logicalOperators[node.Operator]; ok {
+			return c.compileLogicalExpression(node, jump)
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case token.PLUS:
+			c.emit(code.OpAdd)
+		case token.MINUS:
+			c.emit(code.OpSub)
+		case token.ASTERISK:
+			c.emit(code.OpMul)
+		case token.SLASH:
+			c.emit(code.OpDiv)
+		case token.PERCENT:
+			c.emit(code.OpMod)
+		case token.GT:
+			c.emit(code.OpGreaterThan)
+		case token.LT:
+			c.emit(code.OpLessThan)
+		case token.GT_EQ:
+			c.emit(code.OpGreaterEqual)
+		case token.LT_EQ:
+			c.emit(code.OpLessEqual)
+		case token.IN_OPERATOR:
+			c.emit(code.OpIn)
+		case token.EQ:
+			c.emit(code.OpEqual)
+		case token.NOT_EQ:
+			c.emit(code.OpNotEqual)
+		default:
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.IfExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// emit jump with bogus offset, we patch it once the consequence is compiled
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.compileBranch(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			err := c.compileBranch(node.Alternative)
+			if err != nil {
+				return err
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+	case *ast.ConditionalExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		err = c.Compile(node.Alternative)
+		if err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return err
+			}
+
+			err = c.Compile(pair.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		// the null stays on the stack as the result of a?.[k], the index is not evaluated
+		jumpNullPos := -1
+		if node.Optional {
+			jumpNullPos = c.emit(code.OpJumpNull, 9999)
+		}
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+
+		if node.Optional {
+			c.changeOperand(jumpNullPos, len(c.currentInstructions()))
+		}
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpSlice)
+	case *ast.FunctionLiteral:
+		c.enterScope()
+
+		// a function that assigns to its own name sees the binding, the same as in the evaluator
+		if node.Name != "" && !assignsTo(node.Body, node.Name) {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		// implicit return of the last expression
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		positions := c.scopes[c.scopeIndex].positions
+		instructions := c.leaveScope()
+
+		// push free variables on the stack, so OpClosure can capture them
+		for _, s := range freeSymbols {
+			c.captureSymbol(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Name:          node.Name,
+			Instructions:  instructions,
+			Positions:     positions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+		}
+
+		fnIndex := c.addConstant(compiledFn)
+		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	case *ast.MacroLiteral:
+		// top-level macro definitions are removed by evaluator.DefineMacros before the compilation
+		c.emitError("macro literal is only allowed in a top-level let statement")
+	case *ast.CallExpression:
+		// quote is not a regular function, its argument must stay unevaluated
+		if node.Function.TokenLiteral() == "quote" {
+			return c.compileQuote(node)
+		}
+
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.WhileStatement:
+		conditionPos := len(c.currentInstructions())
+
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		exitJumpPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		c.enterLoop(conditionPos)
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, conditionPos)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(exitJumpPos, afterLoopPos)
+		c.leaveLoop(afterLoopPos)
+	case *ast.ForStatement:
+		for _, v := range node.Variables {
+			if c.symbolTable.IsConst(v.Value) {
+				c.emitError(fmt.Sprintf("cannot redeclare constant %s", v.Value))
+				return nil
+			}
+		}
+
+		err := c.Compile(node.Iterable)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIterator)
+
+		// the iterator lives in a hidden variable instead of the stack,
+		// so break can jump out of any expression without leaving the stack unbalanced.
+		// The name can not clash with identifiers of the program
+		iterator := c.symbolTable.Define(fmt.Sprintf("@iterator%d", len(c.currentInstructions())))
+		c.storeSymbol(iterator)
+
+		nextPos := len(c.currentInstructions())
+		c.loadSymbol(iterator)
+		iterNextPos := c.emit(code.OpIterNext, 9999, len(node.Variables))
+
+		variables := make([]Symbol, len(node.Variables))
+		for i, v := range node.Variables {
+			variables[i] = c.symbolTable.Define(v.Value)
+		}
+		// the last value is on top of the stack
+		for i := len(variables) - 1; i >= 0; i-- {
+			c.storeSymbol(variables[i])
+		}
+
+		c.enterLoop(nextPos)
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, nextPos)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(iterNextPos, afterLoopPos)
+		c.leaveLoop(afterLoopPos)
+	case *ast.BreakStatement:
+		l, ok := c.currentLoop()
+		if !ok {
+			return c.errorf("break outside of loop")
+		}
+
+		err := c.leaveTries(l.tries)
+		if err != nil {
+			return err
+		}
+
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		l, ok := c.currentLoop()
+		if !ok {
+			return c.errorf("continue outside of loop")
+		}
+
+		err := c.leaveTries(l.tries)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpJump, l.continuePos)
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpThrow)
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+	default:
+		return c.errorf("unsupported node %T", node)
+	}
+
+	return nil
+}
+
+// compileBranch compiles a block of if. If is an expression, so the value of the last statement has to stay on the stack.
+// A block that is empty or ends with a statement without a value, e.g. let or a loop, leaves null instead
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// compileTryExpression compiles try with the handlers of catch and finally set up around the try block:
+//
+//	OpSetupTry finally, 1   ; only with finally
+//	OpSetupTry catch, 0     ; only with catch
+//	<try block>
+//	OpPopTry                ; only with catch
+//	OpJump afterCatch
+//	catch:      <store the error in the catch parameter> <catch block>
+//	afterCatch: OpPopTry <finally block> OpJump end   ; only with finally
+//	finally:    <finally block> OpRethrow             ; only with finally
+//	end:
+//
+// The value of the try or the catch block stays on the stack, the value of finally is discarded
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	try := &tryBlock{finally: node.Finally}
+
+	finallyPos := -1
+	if node.Finally != nil {
+		finallyPos = c.emit(code.OpSetupTry, 9999, 1)
+		try.handlers++
+	}
+
+	catchPos := -1
+	if node.Catch != nil {
+		catchPos = c.emit(code.OpSetupTry, 9999, 0)
+		try.handlers++
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, try)
+
+	err := c.compileBranch(node.Block)
+	if err != nil {
+		return err
+	}
+
+	if node.Catch != nil {
+		c.emit(code.OpPopTry)
+		try.handlers--
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(catchPos, len(c.currentInstructions()))
+
+		// the catch parameter and the bindings of the catch block are not visible after it
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		c.storeSymbol(c.symbolTable.Define(node.CatchParam.Value))
+		err := c.compileBranch(node.Catch)
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+
+	scope = &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+
+	if node.Finally == nil {
+		return nil
+	}
+
+	c.emit(code.OpPopTry)
+	err = c.Compile(node.Finally)
+	if err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	// the vm gets here with the error on the stack, it is raised again once finally is done
+	c.changeOperand(finallyPos, len(c.currentInstructions()))
+	err = c.Compile(node.Finally)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpRethrow)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// leaveTries prepares a jump out of the try expressions of the function, except for the outermost keep of them.
+// Starting from the innermost one, it removes their handlers and runs their finally blocks
+func (c *Compiler) leaveTries(keep int) error {
+	tries := c.scopes[c.scopeIndex].tries
+
+	for i := len(tries) - 1; i >= keep; i-- {
+		for j := 0; j < tries[i].handlers; j++ {
+			c.emit(code.OpPopTry)
+		}
+
+		if tries[i].finally == nil {
+			continue
+		}
+
+		// a jump out of the finally block must not leave the same try expressions again.
+		// The capacity is limited, so a try inside of finally does not overwrite them
+		c.scopes[c.scopeIndex].tries = tries[:i:i]
+		err := c.Compile(tries[i].finally)
+		c.scopes[c.scopeIndex].tries = tries
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// logicalOperators maps the short-circuiting operators to the jump over their right operand
+var logicalOperators = map[string]code.Opcode{
+	token.AND:     code.OpJumpNotTruthyOrPop,
+	token.OR:      code.OpJumpTruthyOrPop,
+	token.NULLISH: code.OpJumpNotNullOrPop,
+}
+
+// compileLogicalExpression compiles &&, || and ??, the left operand is on the stack already.
+// The right operand is skipped if the left one decides the result
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression, jump code.Opcode) error {
+	jumpPos := c.emit(jump, 9999)
+
+	err := c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// assignsTo reports whether there is an assignment to the name anywhere in the node, nested functions included
+func assignsTo(node ast.Node, name string) bool {
+	found := false
+	ast.Modify(node, func(n ast.Node) ast.Node {
+		if assign, ok := n.(*ast.AssignExpression); ok {
+			if ident, ok := assign.Target.(*ast.Identifier); ok && ident.Value == name {
+				found = true
+			}
+		}
+		return n
+	})
+
+	return found
+}
+
+// compoundOperators maps compound assignment operators to the arithmetic they do
+var compoundOperators = map[string]code.Opcode{
+	token.PLUS_ASSIGN:     code.OpAdd,
+	token.MINUS_ASSIGN:    code.OpSub,
+	token.ASTERISK_ASSIGN: code.OpMul,
+	token.SLASH_ASSIGN:    code.OpDiv,
+}
+
+// compileAssignExpression leaves the assigned value on the stack, assignment is an expression.
+// Compound assignment reads the current value before the new one is evaluated
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	op, compound := compoundOperators[node.Operator]
+	if !compound && node.Operator != token.ASSIGN {
+		return c.errorf("unknown operator %s", node.Operator)
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			// the same as reading the name, the vm fails if it is not defined by the time the code runs
+			symbol = c.resolve(target.Value)
+			c.loadSymbol(symbol)
+			c.emit(code.OpPop)
+		}
+
+		if symbol.Scope == BuiltinScope {
+			c.emitError(fmt.Sprintf("cannot assign to builtin %s", target.Value))
+			return nil
+		}
+
+		if symbol.Const {
+			c.emitError(fmt.Sprintf("cannot assign to constant %s", target.Value))
+			return nil
+		}
+
+		if compound {
+			c.loadSymbol(symbol)
+		}
+
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if compound {
+			c.emit(op)
+		}
+
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+
+		if compound {
+			// keep the collection and the index for OpSetIndex
+			c.emit(code.OpDupPair)
+			c.emit(code.OpIndex)
+		}
+
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if compound {
+			c.emit(op)
+		}
+
+		c.emit(code.OpSetIndex)
+	default:
+		c.emitError(fmt.Sprintf("cannot assign to %s", node.Target.String()))
+	}
+
+	return nil
+}
+
+// resolve returns the symbol of the name. A name that is not defined yet becomes a global,
+// it may be defined later, e.g. a function that is called by a function defined before it.
+// Like in the evaluator, reading the name fails only if it is not defined by the time the code runs
+func (c *Compiler) resolve(name string) Symbol {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		symbol = c.symbolTable.DefineGlobal(name)
+	}
+
+	return symbol
+}
+
+// compileQuote compiles the arguments of the unquote calls, OpQuote splices their values into the quoted code
+func (c *Compiler) compileQuote(node *ast.CallExpression) error {
+	if len(node.Arguments) != 1 {
+		c.emitError(fmt.Sprintf("wrong number of arguments. got=%d, want=1", len(node.Arguments)))
+		return nil
+	}
+
+	calls := object.UnquoteCalls(node.Arguments[0])
+	for _, call := range calls {
+		if len(call.Arguments) != 1 {
+			c.emitErrorAt(call.Pos(), fmt.Sprintf("wrong number of arguments to unquote. got=%d, want=1", len(call.Arguments)))
+			return nil
+		}
+
+		err := c.Compile(call.Arguments[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	quote := &object.Quote{Node: node.Arguments[0]}
+	c.emit(code.OpQuote, c.addConstant(quote), len(calls))
+	return nil
+}
+
+// emitError emits instruction that fails with the message once it is executed,
+// it is used for errors the evaluator reports only if the code runs
+func (c *Compiler) emitError(message string) {
+	c.emit(code.OpError, c.addConstant(&object.String{Value: message}))
+}
+
+// emitErrorAt is emitError that points at pos instead of the node being compiled
+func (c *Compiler) emitErrorAt(pos token.Position, message string) {
+	outerPos := c.currentPos
+	c.currentPos = pos
+	c.emitError(message)
+	c.currentPos = outerPos
+}
+
+// errorf creates compilation error that points at the node being compiled
+func (c *Compiler) errorf(format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	if c.currentPos.IsValid() {
+		msg = c.currentPos.String() + ": " + msg
+	}
+
+	return errors.New(msg)
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Constants:    c.constants,
+		Globals:      c.symbolTable.globalNames(),
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit generates an instruction and adds it to the current scope.
+// It returns the position of the instruction
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+	c.scopes[c.scopeIndex].positions[pos] = c.currentPos
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// changeOperand is used for back-patching jump instructions.
+// It replaces the first operand, the rest of them stay as they are
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[opPos])
+
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		panic(err)
+	}
+
+	operands, _ := code.ReadOperands(def, ins[opPos+1:])
+	operands[0] = operand
+	newInstruction := code.Make(op, operands...)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+		positions:           make(map[int]token.Position),
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// enterLoop starts collecting break and continue jumps of a new loop
+func (c *Compiler) enterLoop(continuePos int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loop{continuePos: continuePos, tries: len(scope.tries)})
+}
+
+// leaveLoop points break jumps of the innermost loop at the end of it
+func (c *Compiler) leaveLoop(afterLoopPos int) {
+	scope := &c.scopes[c.scopeIndex]
+	l := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, afterLoopPos)
+	}
+}
+
+// currentLoop returns the innermost loop of the function being compiled
+func (c *Compiler) currentLoop() (*loop, bool) {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil, false
+	}
+
+	return loops[len(loops)-1], true
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// captureSymbol pushes the variable for OpClosure.
+// Local and free variables are pushed as cells, so the closure shares them with the scope they come from
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocalCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
@@ -0,0 +1,170 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION" // name of the function that is being compiled, used for recursion
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Const bool // declared with const, it can not be assigned to
+}
+
+// SymbolTable associates identifiers with the scope and index
+// so the compiler can emit the right instruction to load or store the binding.
+// Every function literal gets its own table enclosed by the outer one
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// symbols of the outer (non-global) scopes referenced by the function
+	FreeSymbols []Symbol
+
+	// block is set for the table of a block with its own scope, e.g. catch.
+	// Its names are not visible outside of the block, but they take slots of the enclosing function
+	block bool
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable creates table for a block with its own scope inside of the outer one
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// Define defines the name in the scope. A name that is already defined in the scope keeps its slot,
+// let rebinds the variable the same way the evaluator does, so closures that captured it see the new value
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		symbol.Const = false
+		s.store[name] = symbol
+		return symbol
+	}
+
+	// variables of a block live in the slots of the function the block belongs to
+	fn := s
+	for fn.block {
+		fn = fn.Outer
+	}
+
+	symbol := Symbol{Name: name, Index: fn.numDefinitions}
+	if fn.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	fn.numDefinitions++
+	return symbol
+}
+
+// DefineGlobal is Define in the global scope, whatever scope s is
+func (s *SymbolTable) DefineGlobal(name string) Symbol {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	return s.Define(name)
+}
+
+// globalNames returns names of the globals by index
+func (s *SymbolTable) globalNames() []string {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		if symbol.Scope == GlobalScope {
+			names[symbol.Index] = name
+		}
+	}
+
+	return names
+}
+
+// DefineConst is Define for constants
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+
+	s.store[name] = symbol
+	return symbol
+}
+
+// IsConst reports whether the name is a constant defined in this scope,
+// constants of the outer scopes can be shadowed
+func (s *SymbolTable) IsConst(name string) bool {
+	symbol, ok := s.store[name]
+	if !ok || !symbol.Const {
+		return false
+	}
+
+	return symbol.Scope == GlobalScope || symbol.Scope == LocalScope
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		// a block shares variables of the function it belongs to, they are not captured
+		if !ok || s.block {
+			return obj, ok
+		}
+
+		// globals and builtins are reachable from everywhere,
+		// everything else defined in the outer scope has to be captured by the closure
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+
+	return obj, ok
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Const: original.Const}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
@@ -1,85 +1,29 @@
 package evaluator
 
 import (
-	"fmt"
-
 	"github.com/titivuk/go-interpreter/object"
 )
 
 var builtins = map[string]*object.Builtin{
-	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) > 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s",
-					args[0].Type())
-			}
-		},
-	},
-	"rest": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s",
-					args[0].Type())
-			}
-
-			arrObj := args[0].(*object.Array)
-			arrLen := len(arrObj.Elements)
-
-			if arrLen < 1 {
-				return NULL
-			}
-
-			restObj := object.Array{
-				Elements: make([]object.Object, arrLen-1),
-			}
-			copy(restObj.Elements, arrObj.Elements[1:])
-
-			return &restObj
-		},
-	},
-	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2",
-					len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s",
-					args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-
-			newElements := make([]object.Object, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
-
-			return &object.Array{Elements: newElements}
-		},
-	},
-	"puts": {
-		Fn: func(args ...object.Object) object.Object {
-			for _, el := range args {
-				fmt.Println(el.Inspect())
-			}
-
-			return NULL
-		},
-	},
+	"len":   object.GetBuiltinByName("len"),
+	"rest":  object.GetBuiltinByName("rest"),
+	"push":  object.GetBuiltinByName("push"),
+	"puts":  object.GetBuiltinByName("puts"),
+	"int":   object.GetBuiltinByName("int"),
+	"float": object.GetBuiltinByName("float"),
+	"str":   object.GetBuiltinByName("str"),
+
+	"first":    object.GetBuiltinByName("first"),
+	"last":     object.GetBuiltinByName("last"),
+	"map":      object.GetBuiltinByName("map"),
+	"filter":   object.GetBuiltinByName("filter"),
+	"reduce":   object.GetBuiltinByName("reduce"),
+	"sort":     object.GetBuiltinByName("sort"),
+	"reverse":  object.GetBuiltinByName("reverse"),
+	"contains": object.GetBuiltinByName("contains"),
+	"index_of": object.GetBuiltinByName("index_of"),
+	"zip":      object.GetBuiltinByName("zip"),
+	"range":    object.GetBuiltinByName("range"),
+	"flatten":  object.GetBuiltinByName("flatten"),
+	"unique":   object.GetBuiltinByName("unique"),
 }
@@ -2,65 +2,142 @@ package evaluator
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/titivuk/go-interpreter/ast"
 	"github.com/titivuk/go-interpreter/object"
 	"github.com/titivuk/go-interpreter/token"
 )
 
+// MaxCallDepth is the number of nested function calls, the same as the vm allows.
+// vm.MaxFrames counts the frame of the program itself as well
+const MaxCallDepth = 1023
+
 // reuse some objects (similar to oddbals in v8 engine)
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Eval evaluates the node, it is the entry point of the evaluator.
+// A bug in the interpreter must not crash the program that embeds it,
+// so a panic becomes a regular error of the evaluation
+func Eval(node ast.Node, env *object.Environment) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("internal error: %v", r)
+			result.(*object.Error).Pos = node.Pos()
+		}
+	}()
+
+	return eval(node, env)
+}
+
+// eval is called for every node, the innermost node that produced the error knows the best
+// where it happened, so outer nodes do not overwrite the position while the error bubbles up
+func eval(node ast.Node, env *object.Environment) object.Object {
+	result := evalNode(node, env)
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node.Statements, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return eval(node.Expression, env)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return object.NewInteger(node.Big)
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		if node.Operator == token.AND || node.Operator == token.OR || node.Operator == token.NULLISH {
+			return evalLogicalExpression(left, node, env)
+		}
+
+		right := eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalInfixExpression(left, node.Operator, right)
+		return object.BinaryOperation(left, node.Operator, right)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.ConditionalExpression:
+		condition := eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			return eval(node.Consequence, env)
+		}
+
+		return eval(node.Alternative, env)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node.Statements, env)
 	case *ast.ReturnStatement:
 		return evalReturnStatement(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.ThrowStatement:
+		return evalThrowStatement(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.LetStatement:
+		if decl, ok := env.Const(node.Name.Value); ok && decl != node {
+			return newError("cannot redeclare constant %s", node.Name.Value)
+		}
+
 		// if we encounter let statement we need to track expression
 		// for this purpose we use "env"
-		val := Eval(node.Value, env)
+		val := eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
 
-		env.Set(node.Name.Value, val)
+		if node.IsConst() {
+			env.SetConst(node.Name.Value, val, node)
+		} else {
+			env.Set(node.Name.Value, val)
+		}
 	case *ast.Identifier:
 		// if we encounter identifier there should be associated value
 		// we need to replace identifier with that value
@@ -74,10 +151,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 		return newError("identifier not found: " + node.Value)
 	case *ast.FunctionLiteral:
-		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+		return &object.Function{Name: node.Name, Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.MacroLiteral:
+		// top-level macro definitions are removed by DefineMacros before the evaluation
+		return newError("macro literal is only allowed in a top-level let statement")
 	case *ast.CallExpression:
+		// quote is not a regular function, its argument must stay unevaluated
+		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(node.Arguments))
+			}
+
+			return quote(node.Arguments[0], env)
+		}
+
 		// eval always returns *object.Function
-		function := Eval(node.Function, env)
+		function := eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
@@ -87,7 +176,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return applyFunction(function, args, env, node.Pos())
 	case *ast.ArrayLiteral:
 		array := object.Array{}
 		elements := evalExpressions(node.Elements, env)
@@ -100,24 +189,44 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 		return &array
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
+		// the index is not evaluated either, like the right side of &&
+		if node.Optional && left == NULL {
+			return NULL
+		}
+
+		index := eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 
 		return evalIndexExpression(left, index)
-	case *ast.HashLiteral:
-		hash := &object.Hash{
-			Pairs: make(map[object.HashKey]object.HashPair),
+	case *ast.SliceExpression:
+		left := eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		start := evalSliceBound(node.Start, env)
+		if isError(start) {
+			return start
 		}
 
-		for k, v := range node.Pairs {
-			key := Eval(k, env)
+		end := evalSliceBound(node.End, env)
+		if isError(end) {
+			return end
+		}
+
+		return object.Slice(left, start, end)
+	case *ast.HashLiteral:
+		hash := object.NewHash()
+
+		for _, pair := range node.Pairs {
+			key := eval(pair.Key, env)
 			if isError(key) {
 				return key
 			}
@@ -128,15 +237,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 				return newError("unusable as hash key: %s", key.Type())
 			}
 
-			value := Eval(v, env)
+			value := eval(pair.Value, env)
 			if isError(value) {
 				return value
 			}
 
-			hash.Pairs[hashKey.HashKey()] = object.HashPair{
-				Key:   key,
-				Value: value,
-			}
+			hash.Set(hashKey, value)
 		}
 
 		return hash
@@ -149,7 +255,7 @@ func evalProgram(statements []ast.Statement, env *object.Environment) object.Obj
 	var result object.Object
 
 	for _, st := range statements {
-		result = Eval(st, env)
+		result = eval(st, env)
 
 		switch result := result.(type) {
 		// if we encounter return statements or errors
@@ -180,101 +286,148 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 			return FALSE
 		}
 	case token.MINUS:
-		if right.Type() != object.INTEGER_OBJ {
-			return newError("unknown operator: -%s", right.Type())
-		}
-
-		value := right.(*object.Integer).Value
-		return &object.Integer{Value: -value}
+		return object.Negate(right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
-func evalInfixExpression(left object.Object, operator string, right object.Object) object.Object {
-	switch {
-	case right.Type() != left.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
-	case right.Type() == object.INTEGER_OBJ && left.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(left, operator, right)
-	case right.Type() == object.STRING_OBJ && left.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(left, operator, right)
-	case right.Type() == object.BOOLEAN_OBJ && left.Type() == object.BOOLEAN_OBJ:
-		return evalBooleanInfixExpression(left, operator, right)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+// evalLogicalExpression evaluates the right operand only if the left one does not decide the result.
+// The result is one of the operands, not necessarily a boolean, e.g. `null || 5` is 5
+func evalLogicalExpression(left object.Object, ie *ast.InfixExpression, env *object.Environment) object.Object {
+	switch ie.Operator {
+	case token.AND:
+		if !isTruthy(left) {
+			return left
+		}
+	case token.OR:
+		if isTruthy(left) {
+			return left
+		}
+	case token.NULLISH:
+		// unlike ||, only null is replaced, so `false ?? true` is false
+		if left != NULL {
+			return left
+		}
 	}
+
+	return eval(ie.Right, env)
 }
 
-func evalIntegerInfixExpression(left object.Object, operator string, right object.Object) object.Object {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+// evalTemplateLiteral converts the interpolated values to strings the same way as the str builtin does
+func evalTemplateLiteral(tl *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var out strings.Builder
 
-	switch operator {
-	case token.PLUS:
-		return &object.Integer{Value: leftValue + rightValue}
-	case token.MINUS:
-		return &object.Integer{Value: leftValue - rightValue}
-	case token.ASTERISK:
-		return &object.Integer{Value: leftValue * rightValue}
-	case token.SLASH:
-		return &object.Integer{Value: leftValue / rightValue}
-	case token.LT:
-		return nativeBoolToBooleanObject(leftValue < rightValue)
-	case token.GT:
-		return nativeBoolToBooleanObject(leftValue > rightValue)
-	case token.EQ:
-		return nativeBoolToBooleanObject(leftValue == rightValue)
-	case token.NOT_EQ:
-		return nativeBoolToBooleanObject(leftValue != rightValue)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	for i, exp := range tl.Expressions {
+		out.WriteString(tl.Strings[i])
+
+		val := eval(exp, env)
+		if isError(val) {
+			return val
+		}
+
+		out.WriteString(val.Inspect())
 	}
+	out.WriteString(tl.Strings[len(tl.Strings)-1])
+
+	return &object.String{Value: out.String()}
 }
 
-func evalStringInfixExpression(left object.Object, operator string, right object.Object) object.Object {
-	leftValue := left.(*object.String).Value
-	rightValue := right.(*object.String).Value
+// evalAssignExpression updates an existing binding or an element of an array or a hash,
+// the assigned value is the result. Compound assignment reads the current value before the new one is evaluated
+func evalAssignExpression(ae *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		current, ok := env.Get(target.Value)
+		if !ok {
+			if _, ok := builtins[target.Value]; ok {
+				return newError("cannot assign to builtin %s", target.Value)
+			}
 
-	switch operator {
-	case token.PLUS:
-		return &object.String{Value: leftValue + rightValue}
+			return newError("identifier not found: %s", target.Value)
+		}
+
+		if env.IsConst(target.Value) {
+			return newError("cannot assign to constant %s", target.Value)
+		}
+
+		val := evalAssignedValue(ae, current, env)
+		if isError(val) {
+			return val
+		}
+
+		env.Assign(target.Value, val)
+		return val
+	case *ast.IndexExpression:
+		left := eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		var current object.Object
+		if ae.Operator != token.ASSIGN {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := evalAssignedValue(ae, current, env)
+		if isError(val) {
+			return val
+		}
+
+		return object.SetIndex(left, index, val)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError("cannot assign to %s", ae.Target.String())
 	}
 }
 
-func evalBooleanInfixExpression(left object.Object, operator string, right object.Object) object.Object {
-	// we can use pointer comparison because we always use TRUE and FALSE objects
-	switch operator {
-	case token.EQ:
-		return nativeBoolToBooleanObject(left == right)
-	case token.NOT_EQ:
-		return nativeBoolToBooleanObject(left != right)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+// evalAssignedValue evaluates the right side of the assignment,
+// compound operators apply the arithmetic of the infix ones, i.e. `x += 1` is `x = x + 1`
+func evalAssignedValue(ae *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	val := eval(ae.Value, env)
+	if isError(val) || ae.Operator == token.ASSIGN {
+		return val
 	}
+
+	return object.BinaryOperation(current, strings.TrimSuffix(ae.Operator, "="), val)
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+	condition := eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return evalBranch(ie.Consequence, env)
 	}
 
 	if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return evalBranch(ie.Alternative, env)
+	}
+
+	return NULL
+}
+
+// evalBranch evaluates a block of if, a block that is empty or ends with a statement without a value,
+// e.g. let or a loop, makes the if evaluate to null
+func evalBranch(block *ast.BlockStatement, env *object.Environment) object.Object {
+	if result := eval(block, env); result != nil {
+		return result
 	}
 
 	return NULL
 }
 
 func evalReturnStatement(rs *ast.ReturnStatement, env *object.Environment) object.Object {
-	value := Eval(rs.ReturnValue, env)
+	value := eval(rs.ReturnValue, env)
 	if isError(value) {
 		return value
 	}
@@ -282,11 +435,43 @@ func evalReturnStatement(rs *ast.ReturnStatement, env *object.Environment) objec
 	return &object.ReturnValue{Value: value}
 }
 
+// evalThrowStatement turns the value into an error, so it propagates like any other error
+func evalThrowStatement(ts *ast.ThrowStatement, env *object.Environment) object.Object {
+	value := eval(ts.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	return object.NewThrownError(value)
+}
+
+// evalTryExpression evaluates the catch block if the try block fails, the error is bound to the catch parameter.
+// The finally block is evaluated in any case, its value is discarded unless it fails or returns
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := eval(te.Block, env)
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(te.CatchParam.Value, err.Hash())
+
+		result = eval(te.Catch, catchEnv)
+	}
+
+	if te.Finally != nil {
+		finallyResult := eval(te.Finally, env)
+		if interrupts(finallyResult) {
+			return finallyResult
+		}
+	}
+
+	return result
+}
+
 func evalBlockStatement(statements []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, st := range statements {
-		result = Eval(st, env)
+		result = eval(st, env)
 
 		// Here we explicitly don’t unwrap the return value and only check the Type() of each evaluation result.
 		// If it’s object.RETURN_VALUE_OBJECT we simply return the *object.ReturnValue,
@@ -303,18 +488,100 @@ func evalBlockStatement(statements []ast.Statement, env *object.Environment) obj
 		// then, evalProgram checks if it's object.ReturnValue, unwraps it
 		// and stops the execution, i.e. "return 1" is not executed
 		//
-		// the same applies to errors
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		// the same applies to errors, break and continue
+		if interrupts(result) {
+			return result
 		}
 	}
 
 	return result
 }
 
+// interrupts reports whether the result stops evaluation of the enclosing block
+func interrupts(result object.Object) bool {
+	if result == nil {
+		return false
+	}
+
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	default:
+		return false
+	}
+}
+
+// evalLoopBody evaluates one iteration of the loop.
+// It reports false if the loop has to stop, result is not nil if the loop has to pass it further
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (result object.Object, next bool) {
+	result = eval(body, env)
+	if result == nil {
+		return nil, true
+	}
+
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return nil, false
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, false
+	default:
+		return nil, true
+	}
+}
+
+// loops are statements, like let they produce no value
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if result, next := evalLoopBody(ws.Body, env); !next {
+			return result
+		}
+	}
+}
+
+// evalForStatement binds loop variables in the current environment,
+// blocks do not have their own scope, so the variables stay visible after the loop
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	for _, v := range fs.Variables {
+		if _, ok := env.Const(v.Value); ok {
+			return newError("cannot redeclare constant %s", v.Value)
+		}
+	}
+
+	iterable := eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	it, ok := object.NewIterator(iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	for it.Next() {
+		if len(fs.Variables) == 1 {
+			env.Set(fs.Variables[0].Value, it.Item())
+		} else {
+			env.Set(fs.Variables[0].Value, it.Key())
+			env.Set(fs.Variables[1].Value, it.Value())
+		}
+
+		if result, next := evalLoopBody(fs.Body, env); !next {
+			return result
+		}
+	}
+
+	return nil
+}
+
 func evalExpressions(
 	exps []ast.Expression,
 	env *object.Environment,
@@ -322,7 +589,7 @@ func evalExpressions(
 	var result []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		evaluated := eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -332,55 +599,92 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// applyFunction calls fn, env and callPos are the environment and the place it is called from.
+// Errors coming out of the function body get the call recorded in their stack
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment, callPos token.Position) object.Object {
 
 	switch function := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(function, args)
-		evaluated := Eval(function.Body, extendedEnv)
+		if len(args) != len(function.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d",
+				len(function.Parameters), len(args))
+		}
+
+		// Go can not recover from running out of stack, so deep recursion fails before that
+		if env.CallDepth() >= MaxCallDepth {
+			return newError("stack overflow")
+		}
+
+		extendedEnv := extendFunctionEnv(function, args, env)
+		evaluated := eval(function.Body, extendedEnv)
+		if err, ok := evaluated.(*object.Error); ok {
+			err.Stack = append(err.Stack, object.StackFrame{Function: functionName(function.Name), Pos: callPos})
+		}
+
 		// we only want to stop the evaluation of the last called function’s body.
 		// That's why we need unwrap it,
 		// so that evalBlockStatement won’t stop evaluating statements in "outer" functions
-		return unwrapReturnValue(evaluated)
+		if result := unwrapReturnValue(evaluated); result != nil {
+			return result
+		}
+
+		// the body ends with a statement that has no value, e.g. a loop
+		return NULL
 	case *object.Builtin:
-		return function.Fn(args...)
+		// callbacks are reported as called from the place the builtin is called
+		call := func(fn object.Object, args ...object.Object) object.Object {
+			return applyFunction(fn, args, env, callPos)
+		}
+
+		if result := callBuiltin(function, call, args); result != nil {
+			return result
+		}
+
+		return NULL
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func evalIndexExpression(left object.Object, index object.Object) object.Object {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		arrayObj := left.(*object.Array)
-		indexObj := index.(*object.Integer)
-
-		if indexObj.Value < 0 || indexObj.Value >= int64(len(arrayObj.Elements)) {
-			return NULL
+// callBuiltin turns a panic of the builtin into an error of the call,
+// builtins may come from the program that embeds the interpreter
+func callBuiltin(builtin *object.Builtin, call object.CallFunction, args []object.Object) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("internal error: %v", r)
 		}
+	}()
 
-		return arrayObj.Elements[indexObj.Value]
-	case left.Type() == object.HASH_OBJ:
-		hashObj := left.(*object.Hash)
+	return builtin.Fn(call, args...)
+}
 
-		key, ok := index.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", index.Type())
-		}
+func evalIndexExpression(left object.Object, index object.Object) object.Object {
+	if result := object.Index(left, index); result != nil {
+		return result
+	}
 
-		val, ok := hashObj.Pairs[key.HashKey()]
-		if !ok {
-			return NULL
-		}
+	return NULL
+}
 
-		return val.Value
-	default:
-		return newError("index operator not supported: %s", left.Type())
+// evalSliceBound evaluates an omitted bound of the slice to null
+func evalSliceBound(bound ast.Expression, env *object.Environment) object.Object {
+	if bound == nil {
+		return NULL
 	}
+
+	return eval(bound, env)
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+func functionName(name string) string {
+	if name == "" {
+		return object.ANONYMOUS_FUNCTION
+	}
+
+	return name
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object, caller *object.Environment) *object.Environment {
+	env := object.NewCallEnvironment(fn.Env, caller)
 	for paramIdx, param := range fn.Parameters {
 		env.Set(param.Value, args[paramIdx])
 	}
@@ -397,10 +701,7 @@ func unwrapReturnValue(obj object.Object) object.Object {
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
-	if input {
-		return TRUE
-	}
-	return FALSE
+	return object.NativeBoolToBoolean(input)
 }
 
 func isTruthy(obj object.Object) bool {
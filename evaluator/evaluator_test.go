@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/titivuk/go-interpreter/lexer"
@@ -28,6 +29,11 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 + 10 % 4 * 3", 8},
+		{"-9223372036854775808 % -1", 0},
 	}
 
 	for _, tt := range tests {
@@ -246,6 +252,30 @@ if (10 > 1) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"let x = 0; 10 / x + 1",
+			"division by zero",
+		},
+		{
+			"99999999999999999999 / 0",
+			"division by zero",
+		},
+		{
+			"let add = fn(a, b) { a + b }; add(1)",
+			"wrong number of arguments: want=2, got=1",
+		},
+		{
+			"fn() { 1 }(1, 2)",
+			"wrong number of arguments: want=0, got=2",
+		},
+		{
+			"len()",
+			"wrong number of arguments. got=0, want=1",
+		},
 	}
 
 	for _, tt := range tests {
@@ -395,6 +425,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len("привет, 世界")`, 10},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
@@ -420,6 +452,65 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[first([1, 2]), last([1, 2]), first([]), last([])]`, "[1, 2, null, null]"},
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, "[2, 4]"},
+		{`filter([1, [][0], false, 0], fn(x) { x })`, "[1, 0]"},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x }, 10)`, "16"},
+		{`reduce(["a", "b", "c"], fn(acc, x) { x + acc })`, "cba"},
+		{`reduce([], fn(acc, x) { acc + x })`, "null"},
+		{`sort([3, 1.5, 2, 99999999999999999999, -1])`, "[-1, 1.5, 2, 3, 99999999999999999999]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`sort([[2, "b"], [1, "a"], [2, "a"]], fn(a, b) { a[0] < b[0] })`, "[[1, a], [2, b], [2, a]]"},
+		{`let a = [2, 1]; sort(a); a`, "[2, 1]"},
+		{`[reverse([1, 2, 3]), reverse("héllo"), reverse([])]`, "[[3, 2, 1], olléh, []]"},
+		{`[contains([1, [2]], [2]), contains([1], 1.0), contains([1], 2)]`, "[true, true, false]"},
+		{`[contains("hello", "ell"), contains({"a": 1}, "a"), contains({"a": 1}, "b")]`, "[true, true, false]"},
+		// booleans returned by builtins work in conditions
+		{`[if (contains([1], 2)) { 1 } else { 2 }, !contains("a", "b"), contains({}, 1) || 3]`, "[2, true, 3]"},
+		{`[index_of([1, 2, 3], 3), index_of([1], 2), index_of("héllo", "l"), index_of("abc", "x")]`, "[2, -1, 2, -1]"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`zip([1], [2], [3])`, "[[1, 2, 3]]"},
+		{`[range(3), range(1, 4), range(10, 0, -4), range(3, 1)]`, "[[0, 1, 2], [1, 2, 3], [10, 6, 2], []]"},
+		// bounds near the ends of int64 do not overflow
+		{`range(9223372036854775805, 9223372036854775807)`, "[9223372036854775805, 9223372036854775806]"},
+		{`range(9223372036854775806, 9223372036854775807, 2)`, "[9223372036854775806]"},
+		{`range(-9223372036854775807, 9223372036854775807, 9223372036854775807)`, "[-9223372036854775807, 0]"},
+		{`range(0, -9223372036854775807, -9223372036854775807 - 1)`, "[0]"},
+		{`flatten([1, [2, [3]], [], 4])`, "[1, 2, [3], 4]"},
+		{`unique([1, 2, 1.0, "a", [1], [1], "a"])`, "[1, 2, a, [1]]"},
+		// callbacks share the environment they are defined in
+		{`let sum = 0; map([1, 2, 3], fn(x) { sum = sum + x }); sum`, "6"},
+		{`let f = fn(xs) { map(xs, fn(x) { return x + 1; 0 }) }; f([1])`, "[2]"},
+		{`map([1], fn(x) { x + true })`, "ERROR: 1:20: type mismatch: INTEGER + BOOLEAN"},
+		{`map([1], fn(a, b) { a })`, "ERROR: 1:4: wrong number of arguments: want=2, got=1"},
+		{`map([1], 1)`, "ERROR: 1:4: not a function: INTEGER"},
+		{`map(1, fn(x) { x })`, "ERROR: 1:4: argument to `map` must be ARRAY, got INTEGER"},
+		{`sort([1, "a"])`, "ERROR: 1:5: type mismatch: STRING < INTEGER"},
+		{`sort([[1], [2]])`, "ERROR: 1:5: unknown operator: ARRAY < ARRAY"},
+		{`sort([2, 1], fn(a, b) { a < true })`, "ERROR: 1:27: type mismatch: INTEGER < BOOLEAN"},
+		{`reduce([1])`, "ERROR: 1:7: wrong number of arguments. got=1, want=2 or 3"},
+		{`range(0, 5, 0)`, "ERROR: 1:6: range step must not be zero"},
+		{`range(0, 9223372036854775807)`, "ERROR: 1:6: range too large: 9223372036854775807 elements"},
+		{`range(10, -9223372036854775807, -2)`, "ERROR: 1:6: range too large: 4611686018427387909 elements"},
+		{`contains("abc", 1)`, "ERROR: 1:9: argument to `contains` must be STRING to search in STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -482,6 +573,14 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -514,26 +613,46 @@ func TestHashLiterals(t *testing.T) {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+	expected := map[object.Hashable]int64{
+		&object.String{Value: "one"}:   1,
+		&object.String{Value: "two"}:   2,
+		&object.String{Value: "three"}: 3,
+		&object.Integer{Value: 4}:      4,
+		TRUE:                           5,
+		FALSE:                          6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		value, ok := result.Get(expectedKey)
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
 
-		testIntegerObject(t, pair.Value, expectedValue)
+		testIntegerObject(t, value, expectedValue)
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: [1], true: {"z": 0, "y": 1}}`, "{b: 1, a: 2, 3: [1], true: {z: 0, y: 1}}"},
+		{`let h = {"z": 1}; h["a"] = 2; h["z"] = 3; h`, "{z: 3, a: 2}"},
+		{`{"a": 1, "b": 2, "a": 3}`, "{a: 3, b: 2}"},
+		{`let s = ""; let f = fn(x) { s = s + x; x }; {f("c"): f("1"), f("a"): f("2")}; s`, "c1a2"},
+		{`let s = ""; for (k, v in {"c": 1, "a": 2, "b": 3}) { s = s + k + str(v) }; s`, "c1a2b3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong Inspect. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
 	}
 }
 
@@ -570,6 +689,52 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{[1, 2]: 5}[[1, 2]]`,
+			5,
+		},
+		{
+			`{[1, 2]: 5}[[2, 1]]`,
+			nil,
+		},
+		{
+			`{[1]: 5}[[1.0]]`,
+			5,
+		},
+		{
+			`{1.0: 5}[1]`,
+			5,
+		},
+		{
+			`{9223372036854775807: 5}[9223372036854775808.0]`,
+			5,
+		},
+		{
+			`{99999999999999999999: 5}[99999999999999999999.0]`,
+			5,
+		},
+		{
+			`let h = {0.5: 1}; h[1] = 2; h[1.0] = 3; h[1] * 10 + h[0.5]`,
+			31,
+		},
+		{
+			`{{"a": 1, "b": [2]}: 5}[{"b": [2], "a": 1}]`,
+			5,
+		},
+		{
+			`let k = [1]; let h = {k: 5}; k[0] = 2; h[[1]]`,
+			5,
+		},
+		{
+			`let k = [1]; let h = {k: 5}; k[0] = 2; h[k]`,
+			nil,
+		},
+		{
+			`let calls = 0; let memo = {};
+			let add = fn(a, b) { memo[[a, b]] ?? (memo[[a, b]] = calls += 1) };
+			add(1, 2); add(1, 2); add(2, 1); add(1, 2)`,
+			1,
+		},
 	}
 
 	for _, tt := range tests {
@@ -582,3 +747,961 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedInspect string
+	}{
+		{"5 + true;", "ERROR: 1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let a = 1;\n  foobar;", "ERROR: 2:3: identifier not found: foobar"},
+		{"let f = fn() {\n  -true\n};\nf();", "ERROR: 2:3: unknown operator: -BOOLEAN"},
+		{`len(1)`, "ERROR: 1:4: argument to `len` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Inspect() != tt.expectedInspect {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedInspect, errObj.Inspect())
+		}
+	}
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`let s = "世界"; s[1]`, "界"},
+		{`"héllo"[5]`, nil},
+		{`"héllo"[-1]`, "o"},
+		{`"héllo"[-4]`, "é"},
+		{`"héllo"[-6]`, nil},
+		{`""[0]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let größe = 5; let 名前 = größe * 2; 名前`
+
+	testIntegerObject(t, testEval(input), 10)
+}
+
+func TestFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 2.25", 3.75},
+		{"10 / 4.0", 2.5},
+		{"10 / 4", 2},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"3 - 0.5", 2.5},
+		{"1e3 / 8", 125.0},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+		{"1 == 1.0", true},
+		{"1.5 != 1.5", false},
+		{"let avg = fn(a, b) { (a + b) / 2.0 }; avg(3, 4)", 3.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2.0", "2.0"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"1e21", "1e+21"},
+		{"-0.5", "-0.5"},
+		{"1.0 / 0", "+Inf"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong Inspect. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{"int(7)", 7},
+		{`int(" 42 ")`, 42},
+		{`int("4.2")`, `could not parse "4.2" as integer`},
+		{`int(true)`, "argument to `int` not supported, got BOOLEAN"},
+		{"int(1e20)", "100000000000000000000"},
+		{"int(1.0 / 0)", "could not convert +Inf to integer"},
+		{"float(3)", 3.0},
+		{"float(2.5)", 2.5},
+		{`float("1.25")`, 1.25},
+		{`float("abc")`, `could not parse "abc" as float`},
+		{"float(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"str(1.5)", "1.5"},
+		{"str([1, true])", "[1, true]"},
+		{`str("a")`, "a"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.BigInt:
+				if obj.Inspect() != expected {
+					t.Errorf("%q: wrong big integer. expected=%s, got=%s", tt.input, expected, obj.Inspect())
+				}
+			default:
+				t.Errorf("%q: unexpected object %T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4611686018427387904 * 2", "9223372036854775808"},
+		{"-1 * -9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775808 / -1", "9223372036854775808"},
+		{"-(-9223372036854775808)", "9223372036854775808"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+		{"123456789012345678901234567890 / 10", "12345678901234567890123456789"},
+		{"let factorial = fn(n) { if (n < 2) { 1 } else { n * factorial(n - 1) } }; factorial(25)", "15511210043330985984000000"},
+		{"99999999999999999999 > 1", "true"},
+		{"99999999999999999999 == 99999999999999999999", "true"},
+		{"99999999999999999999 + 0.5", "1e+20"},
+		{"99999999999999999999 + true", "ERROR: 1:22: type mismatch: BIGINT + BOOLEAN"},
+		{`int("99999999999999999999")`, "99999999999999999999"},
+		{"float(99999999999999999999)", "1e+20"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBigIntegersDemoteToInteger(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"99999999999999999999 / 99999999999999999999", 1},
+		{"-9223372036854775808", -9223372036854775808},
+		{`{9223372036854775808 - 1: 5}[9223372036854775807]`, 5},
+		{`{99999999999999999999: 5}[99999999999999999998 + 1]`, 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPanicsBecomeErrors(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("explode", &object.Builtin{Fn: func(_ object.CallFunction, args ...object.Object) object.Object {
+		panic("something went wrong")
+	}})
+
+	l := lexer.New("let x = 1;\nx + explode()")
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	evaluated := Eval(program, env)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Inspect() != "ERROR: 2:12: internal error: something went wrong" {
+		t.Errorf("wrong error. got=%q", errObj.Inspect())
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(n) { f(n + 1) }; f(0)", "ERROR: 1:18: stack overflow"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(1022)", "1022"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(1023)", "ERROR: 1:47: stack overflow"},
+		// calls made by builtins count as well
+		{"let f = fn(n) { map([n], f) }; f(0)", "ERROR: 1:20: stack overflow"},
+		// the depth is the one of the caller, not of the environment the function is defined in
+		{"let g = fn() { fn() { 1 } }; let h = g(); let f = fn(n) { if (n == 0) { h() } else { f(n - 1) } }; f(1021)", "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStack []string
+	}{
+		{"1 + true", []string{}},
+		{"let f = fn() { 1 + true }; f()", []string{"f 1:29"}},
+		{
+			"let inner = fn(x) { x / 0 };\nlet outer = fn(x) { inner(x) + 1 };\nouter(1);",
+			[]string{"inner 2:26", "outer 3:6"},
+		},
+		{"fn() { -true }()", []string{"<anonymous> 1:15"}},
+		{"let f = fn(g) { g() }; f(fn() { len(1) })", []string{"<anonymous> 1:18", "f 1:25"}},
+		// arguments are checked before the call happens
+		{"let f = fn(x) { x }; f()", []string{}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		stack := []string{}
+		for _, frame := range errObj.Stack {
+			stack = append(stack, frame.Function+" "+frame.Pos.String())
+		}
+
+		if strings.Join(stack, ", ") != strings.Join(tt.expectedStack, ", ") {
+			t.Errorf("%q: wrong stack. expected=%v, got=%v", tt.input, tt.expectedStack, stack)
+		}
+	}
+}
+
+func TestTraceback(t *testing.T) {
+	input := "let f = fn(n) { if (n == 0) { 1 / 0 } else { f(n - 1) } }; f(30)"
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+
+	lines := strings.Split(errObj.Traceback(), "\n")
+
+	// 31 calls do not fit, so the middle of the recursion is omitted
+	expected := []string{
+		"ERROR: 1:33: division by zero",
+		"Traceback (most recent call first):",
+		"  f called at 1:47",
+	}
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Errorf("line %d wrong. expected=%q, got=%q", i, line, lines[i])
+		}
+	}
+
+	if len(lines) != 2+2*object.MAX_TRACEBACK_FRAMES+1 {
+		t.Errorf("wrong number of lines. got=%d", len(lines))
+	}
+
+	if lines[2+object.MAX_TRACEBACK_FRAMES] != "  ... 11 more calls ..." {
+		t.Errorf("omitted calls line wrong. got=%q", lines[2+object.MAX_TRACEBACK_FRAMES])
+	}
+
+	if lines[len(lines)-1] != "  f called at 1:61" {
+		t.Errorf("outermost call wrong. got=%q", lines[len(lines)-1])
+	}
+}
+
+func TestThrow(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`throw "boom"`, "ERROR: 1:1: boom"},
+		{`1; throw 40 + 2; 3`, "ERROR: 1:4: 42"},
+		{`throw {"message": "not found", "code": 404}`, "ERROR: 1:1: not found"},
+		{`let f = fn() { throw [1, 2] }; f()`, "ERROR: 1:16: [1, 2]"},
+		{`throw 1 + true`, "ERROR: 1:9: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Inspect() != tt.expectedMessage {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Inspect())
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom"; 1 } catch (e) { 2 }`, 2},
+		{`try { throw "boom" } catch (e) { e["message"] }`, "boom"},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER"},
+		{`try { throw {"code": 7} } catch (e) { e["value"]["code"] }`, 7},
+		{`try { 1 / 0 } catch (e) { e["value"] }`, nil},
+		{"try {\n  1 + true\n} catch (e) { e[\"position\"] }", "2:5"},
+		{
+			"let inner = fn() { throw \"boom\" };\nlet outer = fn() { inner() };\ntry { outer() } catch (e) { e[\"stack\"] }",
+			[]string{"inner called at 2:25", "outer called at 3:12"},
+		},
+		// the catch parameter does not leak out of the catch block
+		{`try { throw "boom" } catch (e) { 1 }; e`, "identifier not found: e"},
+		// catch can throw again
+		{`try { try { throw "inner" } catch (e) { throw e } } catch (e) { e["message"] }`, "inner"},
+		{`try { try { throw "inner" } catch (e) { throw "outer" } } catch (e) { e["message"] }`, "outer"},
+		// uncaught error inside catch
+		{`try { throw "a" } catch (e) { throw "b" }`, "b"},
+		// return passes through try
+		{`let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()`, 1},
+		{`let f = fn() { try { throw "x" } catch (e) { return 2; }; 3 }; f()`, 2},
+		{`let f = fn() { let v = try { throw "x" } catch (e) { 5 }; v * 2 }; f()`, 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("%q: unexpected object %T (%+v)", tt.input, evaluated, evaluated)
+			}
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%q: object not Array: %T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			got := []string{}
+			for _, el := range array.Elements {
+				got = append(got, el.Inspect())
+			}
+
+			if strings.Join(got, "; ") != strings.Join(expected, "; ") {
+				t.Errorf("%q: wrong array. expected=%v, got=%v", tt.input, expected, got)
+			}
+		}
+	}
+}
+
+func TestFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// finally runs, but its value is discarded
+		{`let r = try { 1 } finally { 2 }; r`, 1},
+		{`try { throw "boom" } catch (e) { 2 } finally { 3 }`, 2},
+		// the error passes through try without catch after finally runs
+		{`try { throw "boom" } finally { 3 }`, "boom"},
+		// a failure or a return in finally wins
+		{`try { 1 } finally { throw "finally" }`, "finally"},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, 2},
+		{`let f = fn() { try { throw "x" } finally { return 2; } }; f()`, 2},
+		// finally sees bindings made in try
+		{`let f = fn() { try { let a = 5; throw "x" } catch (e) { 1 } finally { return a; } }; f()`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let i = 0; let sum = 0; while (i < 5) { let sum = sum + i; let i = i + 1; }; sum`, 10},
+		{`let i = 0; while (true) { let i = i + 1; if (i == 3) { break; } }; i`, 3},
+		{`while (false) { throw "never" }; 1`, 1},
+		{`let n = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } let n = n + x; }; n`, 8},
+		{`let n = 0; for (i, x in [10, 20]) { let n = n + i * x; }; n`, 20},
+		{`let s = ""; for (ch in "héllo") { let s = ch + s; }; s`, "olléh"},
+		{`let s = ""; for (k in {"b": 2, "a": 1}) { let s = s + k; }; s`, "ba"},
+		{`let s = ""; for (k, v in {"b": 2, "a": 1}) { let s = s + k + str(v); }; s`, "b2a1"},
+		// the loop variable stays visible after the loop
+		{`for (x in [1, 2, 3]) { if (x == 2) { break; } }; x`, 2},
+		// break stops only the innermost loop
+		{`let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } let n = n + 1; } }; n`, 2},
+		{`let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } }; 0 }; f()`, 20},
+		{`let f = fn() { for (x in []) { } }; f()`, nil},
+		{`let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break; } } finally { let n = n + 1; } }; n`, 2},
+		{`try { for (x in [1]) { throw "boom" } } catch (e) { e["message"] }`, "boom"},
+		{`let i = 0; while (i < 3) { i += 1; }; i`, 3},
+		{`let r = []; for (i in [1, 2]) { if (i == 1) { continue; } r = push(r, i) }; len(r)`, 1},
+		{`for (x in 5) { x }`, "cannot iterate over INTEGER"},
+		{`while (1 + true) { 1 }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`for (x in [1]) { x + true }`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("%q: object is not String or Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let x = 1; x = 2; x`, 2},
+		{`let x = 1; x = x + 1`, 2},
+		{`let a = 1; let b = 2; a = b = 5; a + b`, 10},
+		{`let x = 10; x -= 3; x *= 4; x /= 2; x`, 14},
+		{`let f = fn(x) { x += 1; x }; f(41)`, 42},
+		// assignment updates the nearest binding
+		{`let x = 1; let f = fn() { x = 10 }; f(); x`, 10},
+		{`let x = 1; let f = fn() { let x = 2; x = 3 }; f(); x`, 1},
+		{`let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()`, 3},
+		{`let i = 0; let s = 0; while (i < 4) { s += i; i += 1; }; s`, 6},
+		{`let a = [1, 2, 3]; a[1] = 20; a[1] += 5; a[1]`, 25},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] += 10; h["a"] + h["b"]`, 13},
+		{`let a = [1]; let b = a; b[0] = 5; a[0]`, 5},
+		{`let h = {}; (h["k"] = 7) + 1`, 8},
+		{`x = 1`, "identifier not found: x"},
+		{`len = 1`, "cannot assign to builtin len"},
+		{`let x = 1; x += "a"`, "type mismatch: INTEGER + STRING"},
+		{`let a = [1]; a[5] = 1`, "index out of range: 5"},
+		{`let s = "ab"; s[0] = "c"`, "index assignment not supported: STRING[INTEGER]"},
+		{`let a = [1]; a["x"] = 1`, "index assignment not supported: ARRAY[STRING]"},
+		{`let h = {}; h[fn() {}] = 1`, "unusable as hash key: FUNCTION"},
+		{`let h = {}; h["a"] += 1`, "type mismatch: NULL + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestConst(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`const x = 5; x * 2`, 10},
+		{`const x = 5; let f = fn() { let x = 1; x = 2; x }; f()`, 2},
+		{`const x = 5; let f = fn(x) { x += 1 }; f(1)`, 2},
+		{`const a = [1]; a[0] = 2; a[0]`, 2},
+		// running the same declaration again is not a redeclaration
+		{`let n = 0; for (x in [1, 2, 3]) { const y = x * 2; n += y; }; n`, 12},
+		{`const x = 5; x = 6`, "cannot assign to constant x"},
+		{`const x = 5; x += 1`, "cannot assign to constant x"},
+		{`const x = 5; let f = fn() { x = 6 }; f()`, "cannot assign to constant x"},
+		{`const x = 5; let x = 6`, "cannot redeclare constant x"},
+		{`const x = 5; const x = 6`, "cannot redeclare constant x"},
+		{`const x = 5; if (true) { let x = 6 }`, "cannot redeclare constant x"},
+		{`const x = 5; for (x in [1]) { }`, "cannot redeclare constant x"},
+		{`const x = 5; for (i, x in [1]) { }`, "cannot redeclare constant x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		// the result is the operand that decided it
+		{"1 && 2", 2},
+		{"0 && 2", 2},
+		{"[][0] && 2", nil},
+		{"false && 2", false},
+		{"1 || 2", 1},
+		{"[][0] || 2", 2},
+		{"false || [][0]", nil},
+		{"1 < 2 && 2 <= 2 && 3 >= 3", true},
+		// the right operand is not evaluated once the left one decides the result
+		{"false && 1 + true", false},
+		{"true || undefinedName", true},
+		{"let n = 0; let f = fn() { n += 1; true }; false && f(); true || f(); n", 0},
+		{"let n = 0; let f = fn() { n += 1; true }; true && f(); false || f(); n", 2},
+		{"true && 1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"false || undefinedName", "identifier not found: undefinedName"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestComparisonAndModulo(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"1.5 <= 1.5", true},
+		{"2 >= 1.5", true},
+		{"99999999999999999999 >= 99999999999999999999", true},
+		{"99999999999999999999 <= 1", false},
+		{"7.5 % 2", 1.5},
+		{"-7.5 % 2", -1.5},
+		{"99999999999999999999 % 10", 9},
+		{"-99999999999999999999 % 10", -9},
+		{"7 % 0", "division by zero"},
+		{"99999999999999999999 % 0", "division by zero"},
+		{"true <= false", "unknown operator: BOOLEAN <= BOOLEAN"},
+		{`"a" % "b"`, "unknown operator: STRING % STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestConditionalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true ? 1 : 2", 1},
+		{"false ? 1 : 2", 2},
+		{"[][0] ? 1 : 2", 2},
+		{"0 ? 1 : 2", 1},
+		{"let x = 5; x > 3 ? x * 2 : x", 10},
+		{"let sign = fn(n) { n < 0 ? -1 : n == 0 ? 0 : 1 }; [sign(-5), sign(0), sign(5)][0]", -1},
+		{"let sign = fn(n) { n < 0 ? -1 : n == 0 ? 0 : 1 }; sign(0) + sign(5)", 1},
+		// the other branch is not evaluated
+		{"true ? 1 : 1 + true", 1},
+		{"false ? 1 + true : 2", 2},
+		{"1 + true ? 1 : 2", "type mismatch: INTEGER + BOOLEAN"},
+		{"[][0] ?? 5", 5},
+		{"1 ?? 5", 1},
+		{"false ?? 5", false},
+		{"[][0] ?? [][0]", nil},
+		{`{"a": 1}["b"] ?? {"a": 1}["a"]`, 1},
+		{"1 ?? 1 + true", 1},
+		{"let n = 0; let f = fn() { n += 1 }; 1 ?? f(); [][0] ?? f(); n", 1},
+		{`let h = {"a": {"b": 5}}; h?.a?.b`, 5},
+		{`let h = {"a": {"b": 5}}; h?.["a"]?.["b"]`, 5},
+		{`let h = {"a": {"b": 5}}; h?.x?.b`, nil},
+		{`let h = {"a": {"b": 5}}; h?.x?.b ?? 0`, 0},
+		{`let h = {"a": [1, 2]}; h?.a?.[1]`, 2},
+		{`let h = {}; h["x"]?.[undefinedName]`, nil},
+		{`let h = {"a": {"b": 5}}; h["x"]["b"]`, "index operator not supported: NULL"},
+		{`1?.x`, "index operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4, 5][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4, 5][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][3:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:]", "[1, 2, 3, 4, 5]"},
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:-2]", "[1, 2, 3]"},
+		{"[1, 2, 3, 4, 5][-3:-1]", "[3, 4]"},
+		// out of range bounds are clamped
+		{"[1, 2, 3][1:100]", "[2, 3]"},
+		{"[1, 2, 3][-100:1]", "[1]"},
+		{"[1, 2, 3][2:1]", "[]"},
+		{"[1, 2, 3][5:]", "[]"},
+		{"[][0:1]", "[]"},
+		{`"héllo"[1:3]`, "él"},
+		{`"héllo"[-3:]`, "llo"},
+		{`"héllo"[:0]`, ""},
+		{`let s = "hello"; let n = 2; s[n:n + 2]`, "ll"},
+		// a null bound is the same as an omitted one
+		{"[1, 2, 3][[][0]:2]", "[1, 2]"},
+		// the slice is a copy
+		{"let a = [1, 2, 3]; let b = a[:]; b[0] = 10; a", "[1, 2, 3]"},
+		{`[1, 2, 3]["a":]`, "ERROR: 1:10: slice index must be INTEGER, got STRING"},
+		{"[1, 2, 3][:1.5]", "ERROR: 1:10: slice index must be INTEGER, got FLOAT"},
+		{"5[1:2]", "ERROR: 1:2: slice operator not supported: INTEGER"},
+		{`{"a": 1}[1:2]`, "ERROR: 1:9: slice operator not supported: HASH"},
+		{"[1, 2, 3][1 + true:]", "ERROR: 1:13: type mismatch: INTEGER + BOOLEAN"},
+		{"let a = [1, 2, 3]; a[-1] = 30; a[-3] += 10; a", "[11, 2, 30]"},
+		{"let a = [1, 2, 3]; a[-4] = 0", "ERROR: 1:26: index out of range: -4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStringOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"é" == "é"`, true},
+		{`"abc" < "abd"`, true},
+		{`"abc" < "ab"`, false},
+		{`"b" > "abc"`, true},
+		{`"" < "a"`, true},
+		{`"Z" < "a"`, true},
+		{`"é" > "z"`, true},
+		{`"ab" <= "ab"`, true},
+		{`"ab" >= "b"`, false},
+		{`"ell" in "hello"`, true},
+		{`"" in "hello"`, true},
+		{`"lo!" in "hello"`, false},
+		{`"ab" * 3`, "ababab"},
+		{`2 * "é"`, "éé"},
+		{`"ab" * 0`, ""},
+		{`let s = "-"; s * 3 + ">"`, "--->"},
+		{`"ab" * -1`, "ERROR: 1:6: negative repeat count: -1"},
+		{`"ab" * 99999999999`, "ERROR: 1:6: repeat count too large: 99999999999"},
+		{`"" * 99999999999`, ""},
+		{`"ab" * 1.5`, "ERROR: 1:6: type mismatch: STRING * FLOAT"},
+		{`"a" * "b"`, "ERROR: 1:5: unknown operator: STRING * STRING"},
+		{`1 in "abc"`, "ERROR: 1:3: type mismatch: INTEGER in STRING"},
+		{`"a" == 1`, "ERROR: 1:5: type mismatch: STRING == INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Monkey"; "hello ${name}!"`, "hello Monkey!"},
+		{`"${1 + 2} and ${1.5}"`, "3 and 1.5"},
+		{`"${[1, "a"]} ${true} ${[][0]}"`, "[1, a] true null"},
+		{`let f = fn(x) { x * 2 }; "${f(2)}${f(3)}"`, "46"},
+		{`let h = {"k": "v"}; "${h["k"]}"`, "v"},
+		{`let x = 1; "outer ${"inner ${x + 1}"}"`, "outer inner 2"},
+		{`"\${x}"`, "${x}"},
+		{`"cost: $5"`, "cost: $5"},
+		{`"${1 + true}"`, "ERROR: 1:6: type mismatch: INTEGER + BOOLEAN"},
+		{`"${undefinedName}"`, "ERROR: 1:4: identifier not found: undefinedName"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[] == []", true},
+		{"[1, 2, 3] == [1, 2, 3]", true},
+		{"[1, 2, 3] != [1, 2, 3]", false},
+		{"[1, 2, 3] == [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{`[1, "a", true] == [1.0, "a", true]`, true},
+		{`[1, "a"] == [1, 2]`, false},
+		{"[[1, [2]], [3]] == [[1, [2]], [3]]", true},
+		{"[[1, [2]], [3]] == [[1, [4]], [3]]", false},
+		{"[[][0]] == [[][0]]", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} != {"b": 1}`, true},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{"{} == {}", true},
+		{`[{"k": [1, {"x": true}]}] == [{"k": [1, {"x": true}]}]`, true},
+		{"let a = [1, 2]; let b = a; a == b", true},
+		{"let f = fn() {}; [f] == [f]", true},
+		{"[fn() {}] == [fn() {}]", false},
+		{"let a = [1]; a[0] = a; a == a", true},
+		{"(1 < 2) == true", true},
+		{"[1 < 2] == [true]", true},
+		{"[1] == {}", "type mismatch: ARRAY == HASH"},
+		{"[1] == 1", "type mismatch: ARRAY == INTEGER"},
+		{"[1] < [2]", "unknown operator: ARRAY < ARRAY"},
+		{"{} + {}", "unknown operator: HASH + HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
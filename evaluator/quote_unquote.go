@@ -0,0 +1,46 @@
+package evaluator
+
+import (
+	"github.com/titivuk/go-interpreter/ast"
+	"github.com/titivuk/go-interpreter/object"
+)
+
+// quote does not evaluate its argument, it returns the AST node wrapped into *object.Quote.
+// The only exception are `unquote(...)` calls inside the node,
+// they are evaluated and their results are spliced into the quoted code
+func quote(node ast.Node, env *object.Environment) object.Object {
+	values, err := evalUnquoteCalls(node, env)
+	if err != nil {
+		return err
+	}
+
+	node, err = object.Unquote(node, values)
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: node}
+}
+
+// evalUnquoteCalls evaluates arguments of the unquote calls, it stops at the first one that fails.
+// Its error is the result of the quote, since the code can not be built without the value
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ([]object.Object, *object.Error) {
+	values := []object.Object{}
+
+	for _, call := range object.UnquoteCalls(quoted) {
+		if len(call.Arguments) != 1 {
+			err := newError("wrong number of arguments to unquote. got=%d, want=1", len(call.Arguments))
+			err.Pos = call.Pos()
+			return nil, err
+		}
+
+		unquoted := eval(call.Arguments[0], env)
+		if err, ok := unquoted.(*object.Error); ok {
+			return nil, err
+		}
+
+		values = append(values, unquoted)
+	}
+
+	return values, nil
+}
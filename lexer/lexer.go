@@ -1,29 +1,87 @@
 package lexer
 
 import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/titivuk/go-interpreter/token"
 )
 
-// Lexer supports only ASCII
-// it allows us to use byte and access ch by index
+// Lexer reads UTF-8 encoded input rune by rune.
+// Positions are byte offsets into the input, since runes may take up to 4 bytes
 type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current read position in input (after current char)
-	ch           byte // current char under examination
+	ch           rune // current char under examination
+
+	filename string
+	line     int // line of the current char
+	column   int // column of the current char, counted in runes
+
+	// pending is the token that follows the ERROR token of a malformed string,
+	// it is the string itself, so the parser can go on as if the string was fine
+	pending *token.Token
+
+	// interpolations holds the number of unclosed braces of every `${` we are inside of,
+	// the `}` that closes the interpolation continues the string
+	interpolations []int
 }
 
+// messages of ERROR tokens
+const (
+	ERR_UNTERMINATED_COMMENT = "unterminated block comment"
+	ERR_UNTERMINATED_STRING  = "unterminated string"
+	ERR_INVALID_ESCAPE       = "invalid escape sequence"
+)
+
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFilename("", input)
+}
+
+// NewWithFilename creates lexer which stamps filename into position of every token
+func NewWithFilename(filename string, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) NextToken() token.Token {
+	if l.pending != nil {
+		tok := *l.pending
+		l.pending = nil
+		return tok
+	}
+
 	var tok token.Token
+	var errTok *token.Token
 
 	l.skipWhitespace()
 
+	var comments []token.Comment
+	for l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		commentPos := l.currentPosition()
+
+		text, terminated := l.readComment()
+		if !terminated {
+			return token.Token{
+				Type:     token.ERROR,
+				Literal:  ERR_UNTERMINATED_COMMENT,
+				Pos:      commentPos,
+				End:      l.currentPosition(),
+				Comments: comments,
+			}
+		}
+
+		comments = append(comments, token.Comment{Text: text, Pos: commentPos})
+		l.skipWhitespace()
+	}
+
+	// remember where the token starts, reading the token moves the lexer forward
+	pos := l.currentPosition()
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -33,9 +91,19 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.Token{Type: token.ASSIGN, Literal: string(l.ch)}
 		}
 	case '+':
-		tok = token.Token{Type: token.PLUS, Literal: string(l.ch)}
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.PLUS, Literal: string(l.ch)}
+		}
 	case '-':
-		tok = token.Token{Type: token.MINUS, Literal: string(l.ch)}
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.MINUS, Literal: string(l.ch)}
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			tok = token.Token{Type: token.NOT_EQ, Literal: l.input[l.position : l.readPosition+1]}
@@ -44,13 +112,49 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.Token{Type: token.BANG, Literal: string(l.ch)}
 		}
 	case '*':
-		tok = token.Token{Type: token.ASTERISK, Literal: string(l.ch)}
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.ASTERISK, Literal: string(l.ch)}
+		}
 	case '/':
-		tok = token.Token{Type: token.SLASH, Literal: string(l.ch)}
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.SLASH, Literal: string(l.ch)}
+		}
+	case '%':
+		tok = token.Token{Type: token.PERCENT, Literal: string(l.ch)}
 	case '<':
-		tok = token.Token{Type: token.LT, Literal: string(l.ch)}
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.LT_EQ, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.LT, Literal: string(l.ch)}
+		}
 	case '>':
-		tok = token.Token{Type: token.GT, Literal: string(l.ch)}
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.GT_EQ, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.GT, Literal: string(l.ch)}
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = token.Token{Type: token.AND, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = token.Token{Type: token.OR, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		} else {
+			tok = token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}
+		}
 	case ',':
 		tok = token.Token{Type: token.COMMA, Literal: string(l.ch)}
 	case ';':
@@ -60,28 +164,77 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = token.Token{Type: token.RPAREN, Literal: string(l.ch)}
 	case '{':
+		if len(l.interpolations) > 0 {
+			l.interpolations[len(l.interpolations)-1]++
+		}
 		tok = token.Token{Type: token.LBRACE, Literal: string(l.ch)}
 	case '}':
-		tok = token.Token{Type: token.RBRACE, Literal: string(l.ch)}
+		depth := len(l.interpolations) - 1
+		if depth < 0 || l.interpolations[depth] > 0 {
+			if depth >= 0 {
+				l.interpolations[depth]--
+			}
+			tok = token.Token{Type: token.RBRACE, Literal: string(l.ch)}
+			break
+		}
+
+		l.interpolations = l.interpolations[:depth]
+
+		var value string
+		value, errTok = l.readString()
+		tok = token.Token{Type: token.TEMPLATE_END, Literal: value}
+		if l.ch == '{' {
+			tok.Type = token.TEMPLATE_MIDDLE
+		}
 	case '"':
-		tok = token.Token{Type: token.STRING, Literal: string(l.readString())}
+		var value string
+		value, errTok = l.readString()
+		tok = token.Token{Type: token.STRING, Literal: value}
+		if l.ch == '{' {
+			tok.Type = token.TEMPLATE_START
+		}
+	case '`':
+		var value string
+		value, errTok = l.readRawString()
+		tok = token.Token{Type: token.STRING, Literal: value}
 	case '[':
 		tok = token.Token{Type: token.LBRACKET, Literal: string(l.ch)}
 	case ']':
 		tok = token.Token{Type: token.RBRACKET, Literal: string(l.ch)}
 	case ':':
 		tok = token.Token{Type: token.COLON, Literal: string(l.ch)}
+	case '?':
+		switch l.peekChar() {
+		case '?':
+			tok = token.Token{Type: token.NULLISH, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		case '.':
+			tok = token.Token{Type: token.OPTIONAL_CHAIN, Literal: l.input[l.position : l.readPosition+1]}
+			l.readChar()
+		default:
+			tok = token.Token{Type: token.QUESTION, Literal: string(l.ch)}
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
+		tok.Pos = pos
+		tok.End = pos
+		tok.Comments = comments
+		l.readChar()
+		return tok
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
+			tok.End = l.currentPosition()
+			tok.Comments = comments
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
+			tok.End = l.currentPosition()
+			tok.Comments = comments
 			return tok
 		} else {
 			tok = token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}
@@ -90,6 +243,15 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.readChar()
 
+	tok.Pos = pos
+	tok.End = l.currentPosition()
+	if errTok != nil {
+		l.pending = &tok
+		errTok.Comments = comments
+		return *errTok
+	}
+
+	tok.Comments = comments
 	return tok
 }
 
@@ -99,61 +261,264 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// readComment reads `// ...` till the end of the line or `/* ... */`, which may span multiple lines.
+// It reports false if the block comment is not closed before the end of the input
+func (l *Lexer) readComment() (string, bool) {
+	position := l.position
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+
+		return l.input[position:l.position], true
+	}
+
+	// skip "/*"
+	l.readChar()
+	l.readChar()
+
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.ch == 0 {
+			return l.input[position:l.position], false
+		}
+		l.readChar()
+	}
+
+	// skip "*/"
+	l.readChar()
+	l.readChar()
+
+	return l.input[position:l.position], true
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+		l.position = l.readPosition
+		l.readPosition += 1
+		return
 	}
 
+	// invalid UTF-8 decodes into utf8.RuneError of size 1, it becomes ILLEGAL token
+	ch, size := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = ch
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += size
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{Filename: l.filename, Offset: l.position, Line: l.line, Column: l.column}
+}
+
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
 
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 
-	for isLetter(l.ch) {
+	// identifier starts with a letter, digits are allowed after it, e.g. x1
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
 
 	return l.input[position:l.position]
 }
 
-// for simplicity only decimal integers are supported
-func (l *Lexer) readNumber() string {
+// readNumber reads decimal integer or float, e.g. 10, 1.5, 2e10, 1.5e-3.
+// The fraction and the exponent need at least one digit, otherwise they are not a part of the number
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+
+	l.readDigits()
 
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if (l.ch == 'e' || l.ch == 'E') && l.isExponent() {
+		tokenType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		l.readDigits()
+	}
+
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
+}
+
+// isExponent checks that "e" is followed by digits, optionally with a sign
+func (l *Lexer) isExponent() bool {
+	rest := l.input[l.readPosition:]
+	if len(rest) > 0 && (rest[0] == '+' || rest[0] == '-') {
+		rest = rest[1:]
+	}
 
-	return l.input[position:l.position]
+	return len(rest) > 0 && isDigit(rune(rest[0]))
+}
+
+// readString reads "..." string and decodes escape sequences: \n, \t, \", \\, \$ and \u{...}.
+// The string can not span lines, use raw string for that.
+// The lexer stays on the closing quote or on the `{` of the interpolation.
+// A malformed string gives ERROR token along with the string read so far, invalid escapes are left out of it.
+// Invalid escape does not stop reading, so the lexer continues after the string.
+// It also reads the rest of the string after the `}` of the interpolation
+func (l *Lexer) readString() (string, *token.Token) {
+	start := l.currentPosition()
+	var out strings.Builder
+	var errTok *token.Token
+
+	l.readChar()
+
+	for l.ch != '"' {
+		if l.ch == 0 || l.ch == '\n' {
+			return out.String(), &token.Token{Type: token.ERROR, Literal: ERR_UNTERMINATED_STRING, Pos: start, End: l.currentPosition()}
+		}
+
+		// the lexer stops at the `{`, so the caller can tell the interpolation from the end of the string
+		if l.ch == '$' && l.peekChar() == '{' {
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			break
+		}
+
+		if l.ch != '\\' {
+			out.WriteRune(l.ch)
+			l.readChar()
+			continue
+		}
+
+		escapePos := l.currentPosition()
+		escapeStart := l.position
+
+		ch, ok := l.readEscape()
+		if !ok && errTok == nil {
+			errTok = &token.Token{
+				Type:    token.ERROR,
+				Literal: ERR_INVALID_ESCAPE + " " + l.input[escapeStart:l.position],
+				Pos:     escapePos,
+				End:     l.currentPosition(),
+			}
+		}
+		if ok {
+			out.WriteRune(ch)
+		}
+	}
+
+	return out.String(), errTok
 }
 
-func (l *Lexer) readString() string {
+// readEscape reads escape sequence starting at the backslash and leaves the lexer after it
+func (l *Lexer) readEscape() (rune, bool) {
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		l.readChar()
+		return '\n', true
+	case 't':
+		l.readChar()
+		return '\t', true
+	case '"':
+		l.readChar()
+		return '"', true
+	case '$':
+		l.readChar()
+		return '$', true
+	case '\\':
+		l.readChar()
+		return '\\', true
+	case 'u':
+		return l.readUnicodeEscape()
+	case 0, '\n':
+		// unterminated string is reported by the caller
+		return 0, false
+	}
+
+	l.readChar()
+	return 0, false
+}
+
+// readUnicodeEscape reads code point of \u{...}, it is written with 1 to 6 hex digits
+func (l *Lexer) readUnicodeEscape() (rune, bool) {
+	l.readChar()
+	if l.ch != '{' {
+		return 0, false
+	}
 	l.readChar()
 
 	position := l.position
-	for l.ch != '"' && l.ch != 0 {
+	for isHexDigit(l.ch) {
 		l.readChar()
 	}
+	digits := l.input[position:l.position]
 
-	return l.input[position:l.position]
+	if l.ch != '}' {
+		return 0, false
+	}
+	l.readChar()
+
+	if len(digits) == 0 || len(digits) > 6 {
+		return 0, false
+	}
+
+	value, err := strconv.ParseInt(digits, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(value)) {
+		return 0, false
+	}
+
+	return rune(value), true
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// readRawString reads `...` string as it is, without escapes. It may span multiple lines.
+// The lexer stays on the closing backtick, an unterminated string gives ERROR token along with the rest of the input
+func (l *Lexer) readRawString() (string, *token.Token) {
+	start := l.currentPosition()
+
+	l.readChar()
+
+	position := l.position
+	for l.ch != '`' {
+		if l.ch == 0 {
+			return l.input[position:l.position], &token.Token{Type: token.ERROR, Literal: ERR_UNTERMINATED_STRING, Pos: start, End: l.currentPosition()}
+		}
+		l.readChar()
+	}
+
+	return l.input[position:l.position], nil
 }
 
-func isDigit(ch byte) bool {
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
+}
+
+// only ASCII digits form number literals, other scripts' digits are allowed in identifiers
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
@@ -15,7 +15,7 @@ func TestNextToken(t *testing.T) {
 	};
 	
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 	
 	if (5 < 10) {
@@ -142,3 +142,581 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.STRING, 2, 7},
+		{token.SEMICOLON, 2, 11},
+		{token.EOF, 2, 12},
+	}
+
+	l := NewWithFilename("main.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Filename != "main.mk" {
+			t.Fatalf("tests[%d] - filename wrong. got=%q", i, tok.Pos.Filename)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
+
+func TestTokenEndPositions(t *testing.T) {
+	input := "x == \"a\\nb\" `c`\n\"${y}z\""
+
+	tests := []struct {
+		expectedType      token.TokenType
+		expectedEndLine   int
+		expectedEndColumn int
+		expectedEndOffset int
+	}{
+		{token.IDENT, 1, 2, 1},
+		{token.EQ, 1, 5, 4},
+		// the literal is decoded, the end is taken from the source
+		{token.STRING, 1, 12, 11},
+		{token.STRING, 1, 16, 15},
+		{token.TEMPLATE_START, 2, 4, 19},
+		{token.IDENT, 2, 5, 20},
+		{token.TEMPLATE_END, 2, 8, 23},
+		{token.EOF, 2, 8, 23},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.End.Line != tt.expectedEndLine || tok.End.Column != tt.expectedEndColumn || tok.End.Offset != tt.expectedEndOffset {
+			t.Fatalf("tests[%d] - end wrong. expected=%d:%d (offset %d), got=%d:%d (offset %d)",
+				i, tt.expectedEndLine, tt.expectedEndColumn, tt.expectedEndOffset, tok.End.Line, tok.End.Column, tok.End.Offset)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing comment
+/* block
+   comment */ x / 2;
+/**/ x
+// comment at the end`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{token.LET, "let", []string{"// leading comment"}},
+		{token.IDENT, "x", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "5", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "x", []string{"// trailing comment", "/* block\n   comment */"}},
+		{token.SLASH, "/", nil},
+		{token.INT, "2", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "x", []string{"/**/"}},
+		{token.EOF, "", []string{"// comment at the end"}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if len(tok.Comments) != len(tt.expectedComments) {
+			t.Fatalf("tests[%d] - wrong number of comments. expected=%d, got=%d",
+				i, len(tt.expectedComments), len(tok.Comments))
+		}
+
+		for j, comment := range tt.expectedComments {
+			if tok.Comments[j].Text != comment {
+				t.Fatalf("tests[%d] - comment wrong. expected=%q, got=%q", i, comment, tok.Comments[j].Text)
+			}
+		}
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	l := New("1 /* a */\n  // b\n2")
+
+	l.NextToken()
+	tok := l.NextToken()
+
+	if len(tok.Comments) != 2 {
+		t.Fatalf("wrong number of comments. got=%d", len(tok.Comments))
+	}
+
+	if pos := tok.Comments[0].Pos; pos.Line != 1 || pos.Column != 3 {
+		t.Errorf("first comment position wrong. got=%d:%d", pos.Line, pos.Column)
+	}
+
+	if pos := tok.Comments[1].Pos; pos.Line != 2 || pos.Column != 3 {
+		t.Errorf("second comment position wrong. got=%d:%d", pos.Line, pos.Column)
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("let x = 1; /* never\nclosed")
+
+	var tok token.Token
+	for i := 0; i < 6; i++ {
+		tok = l.NextToken()
+	}
+
+	if tok.Type != token.ERROR {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.ERROR, tok.Type)
+	}
+
+	if tok.Literal != ERR_UNTERMINATED_COMMENT {
+		t.Fatalf("literal wrong. expected=%q, got=%q", ERR_UNTERMINATED_COMMENT, tok.Literal)
+	}
+
+	if tok.Pos.Line != 1 || tok.Pos.Column != 12 {
+		t.Fatalf("position wrong. got=%d:%d", tok.Pos.Line, tok.Pos.Column)
+	}
+
+	if tok = l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("expected EOF after the error. got=%q", tok.Type)
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := `let größe = "héllo"; привет + 名前 x1 ٣ €`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "größe", 5},
+		{token.ASSIGN, "=", 11},
+		{token.STRING, "héllo", 13},
+		{token.SEMICOLON, ";", 20},
+		{token.IDENT, "привет", 22},
+		{token.PLUS, "+", 29},
+		{token.IDENT, "名前", 31},
+		{token.IDENT, "x1", 34},
+		{token.ILLEGAL, "٣", 37},
+		{token.ILLEGAL, "€", 39},
+		{token.EOF, "", 40},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	l := New("a \xff b")
+
+	expected := []token.TokenType{token.IDENT, token.ILLEGAL, token.IDENT, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"a\tb"`, "a\tb"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"\u{41}\u{e9}\u{1F600}"`, "Aé😀"},
+		{`"\u{10FFFF}"`, "\U0010FFFF"},
+		{"`raw \\n \"string\"`", `raw \n "string"`},
+		{"`multi\nline`", "multi\nline"},
+		{"``", ""},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q (%q)", i, token.STRING, tok.Type, tok.Literal)
+		}
+
+		if tok.Literal != tt.expected {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expected, tok.Literal)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{`x = "abc`, ERR_UNTERMINATED_STRING, 5},
+		{"x = \"abc\ndef\"", ERR_UNTERMINATED_STRING, 5},
+		{"x = `abc", ERR_UNTERMINATED_STRING, 5},
+		{`x = "a\qb"`, ERR_INVALID_ESCAPE + ` \q`, 7},
+		{`x = "\u{110000}"`, ERR_INVALID_ESCAPE + ` \u{110000}`, 6},
+		{`x = "\u{D800}"`, ERR_INVALID_ESCAPE + ` \u{D800}`, 6},
+		{`x = "\u{}"`, ERR_INVALID_ESCAPE + ` \u{}`, 6},
+		{`x = "\u41"`, ERR_INVALID_ESCAPE + ` \u`, 6},
+		{`x = "\`, ERR_UNTERMINATED_STRING, 5},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		l.NextToken() // x
+		l.NextToken() // =
+		tok := l.NextToken()
+
+		if tok.Type != token.ERROR {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, token.ERROR, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+func TestLexingContinuesAfterStringError(t *testing.T) {
+	l := New("\"a\\qb\" + 1; \"abc\nlet")
+
+	// every ERROR token is followed by the string it stands for
+	expected := []token.TokenType{token.ERROR, token.STRING, token.PLUS, token.INT, token.SEMICOLON, token.ERROR, token.STRING, token.LET, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `5 3.14 0.5 1e10 2.5E-3 7e+2 1.foo 3e x.5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "1e10"},
+		{token.FLOAT, "2.5E-3"},
+		{token.FLOAT, "7e+2"},
+		// fraction without digits is not a part of the number
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "foo"},
+		{token.INT, "3"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.ILLEGAL, "."},
+		{token.INT, "5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestAssignmentOperators(t *testing.T) {
+	input := `x = 1; x += 2 -= 3 *= 4 /= 5; x+=-1; a/=/* comment */b`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "2"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "3"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "4"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.IDENT, "b"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	input := `a <= b >= c < d > e; a && b || !c; 7 % 2; a & b | c`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.IDENT, "d"},
+		{token.GT, ">"},
+		{token.IDENT, "e"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.BANG, "!"},
+		{token.IDENT, "c"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "7"},
+		{token.PERCENT, "%"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.ILLEGAL, "&"},
+		{token.IDENT, "b"},
+		{token.ILLEGAL, "|"},
+		{token.IDENT, "c"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestConditionalOperators(t *testing.T) {
+	input := `c ? a : b; a ?? b; h?.["k"]?.field; x ? .5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "c"},
+		{token.QUESTION, "?"},
+		{token.IDENT, "a"},
+		{token.COLON, ":"},
+		{token.IDENT, "b"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "b"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "h"},
+		{token.OPTIONAL_CHAIN, "?."},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.OPTIONAL_CHAIN, "?."},
+		{token.IDENT, "field"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.QUESTION, "?"},
+		{token.ILLEGAL, "."},
+		{token.INT, "5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTemplateStrings(t *testing.T) {
+	input := `"a ${x + {"k": "}"}["k"]} b ${"n${y}"}!" "${}" "\${z}" }`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TEMPLATE_START, "a "},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.STRING, "}"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.TEMPLATE_MIDDLE, " b "},
+		// templates nest
+		{token.TEMPLATE_START, "n"},
+		{token.IDENT, "y"},
+		{token.TEMPLATE_END, ""},
+		{token.TEMPLATE_END, "!"},
+		{token.TEMPLATE_START, ""},
+		{token.TEMPLATE_END, ""},
+		{token.STRING, "${z}"},
+		// outside of the interpolation } is just a brace
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTemplateStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{
+			`"a ${x} b`,
+			[]token.Token{
+				{Type: token.TEMPLATE_START, Literal: "a "},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.ERROR, Literal: ERR_UNTERMINATED_STRING},
+				{Type: token.TEMPLATE_END, Literal: " b"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+		{
+			`"${x}\q"`,
+			[]token.Token{
+				{Type: token.TEMPLATE_START, Literal: ""},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.ERROR, Literal: ERR_INVALID_ESCAPE + " \\q"},
+				{Type: token.TEMPLATE_END, Literal: ""},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("%q: tests[%d] - wrong token. expected=%s(%q), got=%s(%q)",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+	}
+}
@@ -1,21 +1,175 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
 
+	"github.com/titivuk/go-interpreter/ast"
+	"github.com/titivuk/go-interpreter/compiler"
+	"github.com/titivuk/go-interpreter/evaluator"
+	"github.com/titivuk/go-interpreter/lexer"
+	"github.com/titivuk/go-interpreter/object"
+	"github.com/titivuk/go-interpreter/parser"
 	"github.com/titivuk/go-interpreter/repl"
+	"github.com/titivuk/go-interpreter/vm"
 )
 
+// exit codes
+const (
+	EXIT_OK    = 0
+	EXIT_ERROR = 1 // the program failed to parse or evaluated to an error
+	EXIT_USAGE = 2 // wrong command-line arguments
+)
+
+const usage = `Usage:
+  monkey [flags]                 start the REPL
+  monkey [flags] repl            start the REPL
+  monkey [flags] run <file>      run the script
+  monkey [flags] <file>          run the script
+  monkey [flags] -e <code>       evaluate the code and print the result
+
+Flags:
+`
+
 func main() {
+	os.Exit(runCLI(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func runCLI(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	engine := flags.String("engine", repl.ENGINE_EVAL, "backend that executes the program: 'eval' or 'vm'")
+	code := flags.String("e", "", "evaluate the code and print the result")
+	strict := flags.Bool("strict", false, "report names declared twice in the same scope")
+
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+
+	// allow flags after the subcommand as well, e.g. `monkey run -engine=vm script.mk`
+	command := flags.Arg(0)
+	if command == "run" || command == "repl" {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return EXIT_USAGE
+		}
+	} else {
+		command = ""
+	}
+
+	if *engine != repl.ENGINE_EVAL && *engine != repl.ENGINE_VM {
+		fmt.Fprintf(stderr, "unknown engine %q\n", *engine)
+		flags.Usage()
+		return EXIT_USAGE
+	}
+
+	if *code != "" {
+		if command != "" || flags.NArg() > 0 {
+			flags.Usage()
+			return EXIT_USAGE
+		}
+
+		return execute("", *code, *engine, *strict, true, stdout, stderr)
+	}
+
+	switch {
+	case command == "repl" || (command == "" && flags.NArg() == 0):
+		if flags.NArg() > 0 {
+			flags.Usage()
+			return EXIT_USAGE
+		}
+
+		startRepl(stdin, stdout, *engine, *strict)
+		return EXIT_OK
+	case flags.NArg() == 1:
+		filename := flags.Arg(0)
+
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return EXIT_ERROR
+		}
+
+		return execute(filename, string(source), *engine, *strict, false, stdout, stderr)
+	default:
+		flags.Usage()
+		return EXIT_USAGE
+	}
+}
+
+func startRepl(in io.Reader, out io.Writer, engine string, strict bool) {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("Hello %s!. This is the Monkey programming language!\n", user.Username)
-	fmt.Printf("Feel free to type in commands\n")
+	fmt.Fprintf(out, "Hello %s!. This is the Monkey programming language!\n", user.Username)
+	fmt.Fprintf(out, "Feel free to type in commands\n")
+
+	repl.Start(in, out, engine, strict)
+}
+
+// execute runs the whole source with the chosen engine.
+// Errors go to stderr, the result of the program is printed only if printResult is set
+func execute(filename string, source string, engine string, strict bool, printResult bool, stdout io.Writer, stderr io.Writer) int {
+	l := lexer.NewWithFilename(filename, source)
+	p := parser.New(l)
+	p.Strict = strict
+
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		for _, d := range p.Errors() {
+			fmt.Fprintln(stderr, d.String())
+		}
+		return EXIT_ERROR
+	}
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		fmt.Fprintln(stderr, "ERROR: "+err.Error())
+		return EXIT_ERROR
+	}
+
+	var result object.Object
+
+	if engine == repl.ENGINE_VM {
+		comp := compiler.New()
+		err := comp.Compile(expanded)
+		if err != nil {
+			fmt.Fprintln(stderr, "ERROR: "+err.Error())
+			return EXIT_ERROR
+		}
+
+		machine := vm.New(comp.Bytecode())
+		err = machine.Run()
+		if runtimeErr, ok := err.(*vm.RuntimeError); ok {
+			fmt.Fprintln(stderr, "ERROR: "+runtimeErr.Traceback())
+			return EXIT_ERROR
+		}
+
+		if !repl.ProducesNoValue(expanded.(*ast.Program)) {
+			result = machine.LastPoppedStackElem()
+		}
+	} else {
+		result = evaluator.Eval(expanded, object.NewEnvironment())
+		if errObj, ok := result.(*object.Error); ok {
+			fmt.Fprintln(stderr, errObj.Traceback())
+			return EXIT_ERROR
+		}
+	}
+
+	if printResult && result != nil {
+		fmt.Fprintln(stdout, result.Inspect())
+	}
 
-	repl.Start(os.Stdin, os.Stdout)
+	return EXIT_OK
 }
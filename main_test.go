@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCLI(t *testing.T) {
+	dir := t.TempDir()
+
+	script := filepath.Join(dir, "script.mk")
+	writeFile(t, script, "let double = fn(x) { x * 2 };\ndouble(21);\n")
+
+	broken := filepath.Join(dir, "broken.mk")
+	writeFile(t, broken, "let x = ;\n")
+
+	failing := filepath.Join(dir, "failing.mk")
+	writeFile(t, failing, "let x = 1;\nx + true;\n")
+
+	nested := filepath.Join(dir, "nested.mk")
+	writeFile(t, nested, "let inner = fn(x) { x / 0 };\nlet outer = fn(x) { inner(x) + 1 };\nouter(1);\n")
+	nestedTraceback := "ERROR: " + nested + ":1:23: division by zero\n" +
+		"Traceback (most recent call first):\n" +
+		"  inner called at " + nested + ":2:26\n" +
+		"  outer called at " + nested + ":3:6\n"
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{script}, EXIT_OK, "", ""},
+		{[]string{"run", script}, EXIT_OK, "", ""},
+		{[]string{"run", "-engine=vm", script}, EXIT_OK, "", ""},
+		{[]string{"-e", "1 + 2"}, EXIT_OK, "3\n", ""},
+		{[]string{"-engine=vm", "-e", "[1, 2][1] * 3"}, EXIT_OK, "6\n", ""},
+		{[]string{"-e", "let a = 1;"}, EXIT_OK, "", ""},
+		{[]string{"-engine=vm", "-e", "let a = 1;"}, EXIT_OK, "", ""},
+		{[]string{"-engine=vm", "-e", "for (x in [1, 2]) { x }"}, EXIT_OK, "", ""},
+		{[]string{"-e", "let a = 1; let a = 2; a"}, EXIT_OK, "2\n", ""},
+		{[]string{"-strict", "-e", "let a = 1; let a = 2; a"}, EXIT_ERROR, "", "1:16: error: a is already declared in this scope\n"},
+		{[]string{broken}, EXIT_ERROR, "", broken + ":1:9: error: no prefix parse function for ; found\n"},
+		{[]string{failing}, EXIT_ERROR, "", "ERROR: " + failing + ":2:3: type mismatch: INTEGER + BOOLEAN\n"},
+		{[]string{"-engine=vm", failing}, EXIT_ERROR, "", "ERROR: " + failing + ":2:3: type mismatch: INTEGER + BOOLEAN\n"},
+		{[]string{"-e", "foobar"}, EXIT_ERROR, "", "ERROR: 1:1: identifier not found: foobar\n"},
+		{[]string{nested}, EXIT_ERROR, "", nestedTraceback},
+		{[]string{"-engine=vm", nested}, EXIT_ERROR, "", nestedTraceback},
+		{[]string{filepath.Join(dir, "missing.mk")}, EXIT_ERROR, "", ""},
+		{[]string{"-engine=jit", "-e", "1"}, EXIT_USAGE, "", ""},
+		{[]string{"run"}, EXIT_USAGE, "", ""},
+		{[]string{"-e", "1", script}, EXIT_USAGE, "", ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := runCLI(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d (stderr=%q)",
+				tt.args, tt.expectedCode, code, stderr.String())
+		}
+
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("%v: wrong stdout. want=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+
+		if tt.expectedStderr != "" && stderr.String() != tt.expectedStderr {
+			t.Errorf("%v: wrong stderr. want=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func writeFile(t *testing.T, name string, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
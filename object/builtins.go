@@ -0,0 +1,210 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Builtins is shared by the tree-walking evaluator and the vm.
+// The compiler refers to builtins by their index in this slice, so the order matters
+// and new builtins have to be appended to the end.
+//
+// Builtin functions return nil when there is no meaningful result,
+// it is up to the caller to turn it into its null value.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{Fn: func(_ CallFunction, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				// length of a string is the number of characters, not bytes
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			default:
+				return newError("argument to `len` not supported, got %s",
+					args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"rest",
+		&Builtin{Fn: func(_ CallFunction, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `rest` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arrObj := args[0].(*Array)
+			arrLen := len(arrObj.Elements)
+
+			if arrLen < 1 {
+				return nil
+			}
+
+			restObj := Array{
+				Elements: make([]Object, arrLen-1),
+			}
+			copy(restObj.Elements, arrObj.Elements[1:])
+
+			return &restObj
+		},
+		},
+	},
+	{
+		"push",
+		&Builtin{Fn: func(_ CallFunction, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+
+			newElements := make([]Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+
+			return &Array{Elements: newElements}
+		},
+		},
+	},
+	{
+		"puts",
+		&Builtin{Fn: func(_ CallFunction, args ...Object) Object {
+			for _, el := range args {
+				fmt.Println(el.Inspect())
+			}
+
+			return nil
+		},
+		},
+	},
+	{
+		"int",
+		&Builtin{Fn: func(_ CallFunction, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer, *BigInt:
+				return arg
+			case *Float:
+				// the fraction is truncated towards zero
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError("could not convert %s to integer", arg.Inspect())
+				}
+				value, _ := big.NewFloat(arg.Value).Int(nil)
+				return NewInteger(value)
+			case *String:
+				value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+				if !ok {
+					return newError("could not parse %q as integer", arg.Value)
+				}
+				return NewInteger(value)
+			default:
+				return newError("argument to `int` not supported, got %s",
+					args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"float",
+		&Builtin{Fn: func(_ CallFunction, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				return &Float{Value: float64(arg.Value)}
+			case *BigInt:
+				value, _ := new(big.Float).SetInt(arg.Value).Float64()
+				return &Float{Value: value}
+			case *Float:
+				return arg
+			case *String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError("could not parse %q as float", arg.Value)
+				}
+				return &Float{Value: value}
+			default:
+				return newError("argument to `float` not supported, got %s",
+					args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"str",
+		&Builtin{Fn: func(_ CallFunction, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			if str, ok := args[0].(*String); ok {
+				return str
+			}
+
+			return &String{Value: args[0].Inspect()}
+		},
+		},
+	},
+	// collections, see collections.go
+	{"first", &Builtin{Fn: first}},
+	{"last", &Builtin{Fn: last}},
+	{"map", &Builtin{Fn: mapArray}},
+	{"filter", &Builtin{Fn: filter}},
+	{"reduce", &Builtin{Fn: reduce}},
+	{"sort", &Builtin{Fn: sortArray}},
+	{"reverse", &Builtin{Fn: reverse}},
+	{"contains", &Builtin{Fn: contains}},
+	{"index_of", &Builtin{Fn: indexOf}},
+	{"zip", &Builtin{Fn: zip}},
+	{"range", &Builtin{Fn: rangeArray}},
+	{"flatten", &Builtin{Fn: flatten}},
+	{"unique", &Builtin{Fn: unique}},
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+
+	return nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
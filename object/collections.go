@@ -0,0 +1,442 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// collection builtins never modify their arguments, they return new arrays instead.
+// Callbacks are called with call, an error returned by a callback stops the builtin and becomes its result
+
+func first(_ CallFunction, args ...Object) Object {
+	arr, err := arrayArgument("first", 1, 1, args)
+	if err != nil {
+		return err
+	}
+
+	if len(arr.Elements) == 0 {
+		return nil
+	}
+
+	return arr.Elements[0]
+}
+
+func last(_ CallFunction, args ...Object) Object {
+	arr, err := arrayArgument("last", 1, 1, args)
+	if err != nil {
+		return err
+	}
+
+	if len(arr.Elements) == 0 {
+		return nil
+	}
+
+	return arr.Elements[len(arr.Elements)-1]
+}
+
+// map(arr, fn) returns the results of fn(el) for every element
+func mapArray(call CallFunction, args ...Object) Object {
+	arr, err := arrayArgument("map", 2, 2, args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, len(arr.Elements))
+	for i, el := range arr.Elements {
+		result := call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+
+	return &Array{Elements: elements}
+}
+
+// filter(arr, fn) returns the elements fn is truthy for
+func filter(call CallFunction, args ...Object) Object {
+	arr, err := arrayArgument("filter", 2, 2, args)
+	if err != nil {
+		return err
+	}
+
+	elements := []Object{}
+	for _, el := range arr.Elements {
+		result := call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			elements = append(elements, el)
+		}
+	}
+
+	return &Array{Elements: elements}
+}
+
+// reduce(arr, fn, initial) folds the elements from left to right with acc = fn(acc, el).
+// Without initial the first element is the initial value, so reducing an empty array gives null
+func reduce(call CallFunction, args ...Object) Object {
+	arr, err := arrayArgument("reduce", 2, 3, args)
+	if err != nil {
+		return err
+	}
+
+	elements := arr.Elements
+	var acc Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else {
+		if len(elements) == 0 {
+			return nil
+		}
+		acc, elements = elements[0], elements[1:]
+	}
+
+	for _, el := range elements {
+		acc = call(args[1], acc, el)
+		if isError(acc) {
+			return acc
+		}
+	}
+
+	return acc
+}
+
+// sort(arr) sorts numbers and strings in ascending order.
+// sort(arr, fn) puts a before b if fn(a, b) is truthy. The sort is stable in both cases
+func sortArray(call CallFunction, args ...Object) Object {
+	arr, err := arrayArgument("sort", 1, 2, args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, len(arr.Elements))
+	copy(elements, arr.Elements)
+
+	// sort can not be stopped, so once comparison fails the rest of them are skipped
+	var sortErr Object
+	less := func(a, b Object) bool {
+		if sortErr != nil {
+			return false
+		}
+
+		if len(args) == 2 {
+			result := call(args[1], a, b)
+			if isError(result) {
+				sortErr = result
+				return false
+			}
+			return isTruthy(result)
+		}
+
+		cmp, err := compare(a, b)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		return cmp < 0
+	}
+
+	sort.SliceStable(elements, func(i, j int) bool {
+		return less(elements[i], elements[j])
+	})
+
+	if sortErr != nil {
+		return sortErr
+	}
+
+	return &Array{Elements: elements}
+}
+
+// reverse works on arrays and on characters of strings
+func reverse(_ CallFunction, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		elements := make([]Object, len(arg.Elements))
+		for i, el := range arg.Elements {
+			elements[len(elements)-1-i] = el
+		}
+		return &Array{Elements: elements}
+	case *String:
+		runes := []rune(arg.Value)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return &String{Value: string(runes)}
+	default:
+		return newError("argument to `reverse` not supported, got %s", args[0].Type())
+	}
+}
+
+// contains looks for an equal element of an array, a substring of a string or a key of a hash
+func contains(_ CallFunction, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		return NativeBoolToBoolean(indexOfElement(arg, args[1]) >= 0)
+	case *String:
+		substr, ok := args[1].(*String)
+		if !ok {
+			return newError("argument to `contains` must be STRING to search in STRING, got %s", args[1].Type())
+		}
+		return NativeBoolToBoolean(strings.Contains(arg.Value, substr.Value))
+	case *Hash:
+		key, ok := args[1].(Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", args[1].Type())
+		}
+		_, ok = arg.Get(key)
+		return NativeBoolToBoolean(ok)
+	default:
+		return newError("argument to `contains` not supported, got %s", args[0].Type())
+	}
+}
+
+// index_of returns the index of the first equal element of an array
+// or the character index of a substring of a string, it is -1 if there is none
+func indexOf(_ CallFunction, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		return &Integer{Value: int64(indexOfElement(arg, args[1]))}
+	case *String:
+		substr, ok := args[1].(*String)
+		if !ok {
+			return newError("argument to `index_of` must be STRING to search in STRING, got %s", args[1].Type())
+		}
+
+		i := strings.Index(arg.Value, substr.Value)
+		if i < 0 {
+			return &Integer{Value: -1}
+		}
+		// strings are indexed by characters, not bytes
+		return &Integer{Value: int64(len([]rune(arg.Value[:i])))}
+	default:
+		return newError("argument to `index_of` not supported, got %s", args[0].Type())
+	}
+}
+
+// zip(a, b, ...) returns arrays of the elements at the same index, it is as long as the shortest array
+func zip(_ CallFunction, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want at least 1")
+	}
+
+	length := -1
+	for _, arg := range args {
+		arr, ok := arg.(*Array)
+		if !ok {
+			return newError("argument to `zip` must be ARRAY, got %s", arg.Type())
+		}
+		if length < 0 || len(arr.Elements) < length {
+			length = len(arr.Elements)
+		}
+	}
+
+	elements := make([]Object, length)
+	for i := range elements {
+		tuple := make([]Object, len(args))
+		for j, arg := range args {
+			tuple[j] = arg.(*Array).Elements[i]
+		}
+		elements[i] = &Array{Elements: tuple}
+	}
+
+	return &Array{Elements: elements}
+}
+
+// range(end), range(start, end) and range(start, end, step) return integers from start up to, but not including, end
+func rangeArray(_ CallFunction, args ...Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+
+	bounds := make([]int64, len(args))
+	for i, arg := range args {
+		integer, ok := arg.(*Integer)
+		if !ok {
+			return newError("argument to `range` must be INTEGER, got %s", arg.Type())
+		}
+		bounds[i] = integer.Value
+	}
+
+	start, end, step := int64(0), bounds[0], int64(1)
+	if len(bounds) > 1 {
+		start, end = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		step = bounds[2]
+	}
+
+	if step == 0 {
+		return newError("range step must not be zero")
+	}
+
+	// the distance and the step are unsigned, so bounds near the ends of int64 do not overflow
+	var distance, stride uint64
+	if step > 0 && start < end {
+		distance, stride = uint64(end)-uint64(start), uint64(step)
+	} else if step < 0 && start > end {
+		distance, stride = uint64(start)-uint64(end), -uint64(step)
+	}
+
+	length := uint64(0)
+	if distance > 0 {
+		length = (distance-1)/stride + 1
+	}
+
+	if length > MaxRepeatLength {
+		return newError("range too large: %d elements", length)
+	}
+
+	elements := make([]Object, length)
+	for i := range elements {
+		// every element is in between start and end, the product wraps around to the right value
+		elements[i] = &Integer{Value: start + int64(i)*step}
+	}
+
+	return &Array{Elements: elements}
+}
+
+// flatten replaces the nested arrays with their elements, only a single level is flattened
+func flatten(_ CallFunction, args ...Object) Object {
+	arr, err := arrayArgument("flatten", 1, 1, args)
+	if err != nil {
+		return err
+	}
+
+	elements := []Object{}
+	for _, el := range arr.Elements {
+		if nested, ok := el.(*Array); ok {
+			elements = append(elements, nested.Elements...)
+		} else {
+			elements = append(elements, el)
+		}
+	}
+
+	return &Array{Elements: elements}
+}
+
+// unique keeps the first of the equal elements, so [1, 1.0] becomes [1]
+func unique(_ CallFunction, args ...Object) Object {
+	arr, err := arrayArgument("unique", 1, 1, args)
+	if err != nil {
+		return err
+	}
+
+	// elements are grouped by their HashKey the same way keys of a hash are
+	seen := map[HashKey][]Object{}
+	elements := []Object{}
+
+	for _, el := range arr.Elements {
+		hashKey := hashKeyOf(el, map[Object]bool{})
+
+		duplicate := false
+		for _, other := range seen[hashKey] {
+			if Equal(el, other) {
+				duplicate = true
+				break
+			}
+		}
+
+		if !duplicate {
+			seen[hashKey] = append(seen[hashKey], el)
+			elements = append(elements, el)
+		}
+	}
+
+	return &Array{Elements: elements}
+}
+
+// arrayArgument checks the number of arguments and that the first one is an array
+func arrayArgument(name string, min, max int, args []Object) (*Array, *Error) {
+	if len(args) < min || len(args) > max {
+		switch {
+		case min == max:
+			return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), min)
+		case max-min == 1:
+			return nil, newError("wrong number of arguments. got=%d, want=%d or %d", len(args), min, max)
+		default:
+			return nil, newError("wrong number of arguments. got=%d, want=%d to %d", len(args), min, max)
+		}
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	return arr, nil
+}
+
+// compare orders numbers by value and strings lexicographically,
+// other objects can not be compared the same as with the < operator
+func compare(a, b Object) (int, *Error) {
+	if aInt, ok := ToBigInt(a); ok {
+		if bInt, ok := ToBigInt(b); ok {
+			return aInt.Cmp(bInt), nil
+		}
+	}
+
+	if aFloat, ok := toFloat(a); ok {
+		if bFloat, ok := toFloat(b); ok {
+			switch {
+			case aFloat < bFloat:
+				return -1, nil
+			case aFloat > bFloat:
+				return 1, nil
+			default:
+				return 0, nil
+			}
+		}
+	}
+
+	aStr, aIsStr := a.(*String)
+	bStr, bIsStr := b.(*String)
+	if aIsStr && bIsStr {
+		return strings.Compare(aStr.Value, bStr.Value), nil
+	}
+
+	if a.Type() != b.Type() {
+		return 0, newError("type mismatch: %s < %s", a.Type(), b.Type())
+	}
+
+	return 0, newError("unknown operator: %s < %s", a.Type(), b.Type())
+}
+
+func indexOfElement(arr *Array, value Object) int {
+	for i, el := range arr.Elements {
+		if Equal(el, value) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isTruthy mirrors the conditions of the language, only false and null are falsy
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func isError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
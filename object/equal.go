@@ -0,0 +1,112 @@
+package object
+
+import "math/big"
+
+// Equal reports whether the objects are structurally equal, it is what == means for arrays and hashes.
+// Numbers are compared by value regardless of their type, so [1] equals [1.0].
+// Arrays are equal if their elements are equal, hashes are equal if they have equal values under the same keys.
+// Objects without a value of their own, e.g. functions, are only equal to themselves
+func Equal(a, b Object) bool {
+	return equal(a, b, map[[2]Object]bool{})
+}
+
+// equal tracks the pairs of collections which are being compared,
+// an array may contain itself and such a pair is assumed to be equal instead of recursing forever
+func equal(a, b Object, visiting map[[2]Object]bool) bool {
+	if a == b {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Integer, *BigInt, *Float:
+		return equalNumbers(a, b)
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+
+		pair := [2]Object{a, b}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		for i := range a.Elements {
+			if !equal(a.Elements[i], b.Elements[i], visiting) {
+				return false
+			}
+		}
+
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+
+		pair := [2]Object{a, b}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		for _, aPair := range a.Pairs() {
+			bValue, ok := b.Get(aPair.Key.(Hashable))
+			if !ok || !equal(aPair.Value, bValue, visiting) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return false
+	}
+}
+
+// equalNumbers compares integers exactly, an integer and a float are compared as floats like in `1 == 1.0`
+func equalNumbers(a, b Object) bool {
+	aInt, aIsInt := ToBigInt(a)
+	bInt, bIsInt := ToBigInt(b)
+
+	if aIsInt && bIsInt {
+		return aInt.Cmp(bInt) == 0
+	}
+
+	aFloat, ok := toFloat(a)
+	if !ok {
+		return false
+	}
+
+	bFloat, ok := toFloat(b)
+	if !ok {
+		return false
+	}
+
+	return aFloat == bFloat
+}
+
+func toFloat(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value, true
+	case *Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,186 @@
+package object
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// Hashable objects can be keys of a hash. Equal keys must have the same HashKey,
+// but different keys may have the same HashKey too, so Hash compares the keys themselves
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+// comparable struct so we can use it with == and as map key
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash keeps pairs in the order they are added, so printing and iteration are deterministic.
+// Buckets hold the positions of the pairs by the HashKey of their keys.
+// A bucket almost always has a single position, more only if HashKey of different keys collide
+type Hash struct {
+	pairs   []HashPair
+	buckets map[HashKey][]int
+}
+
+func NewHash() *Hash {
+	return &Hash{buckets: make(map[HashKey][]int)}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string  { return inspect(h, map[Object]bool{}) }
+
+// Len returns the number of pairs
+func (h *Hash) Len() int { return len(h.pairs) }
+
+// Get returns the value of the key which is Equal to the given one
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	for _, i := range h.buckets[key.HashKey()] {
+		if Equal(h.pairs[i].Key, key) {
+			return h.pairs[i].Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Set replaces the value of the existing key, the pair keeps its position, or adds a new pair to the end.
+// Arrays and hashes are copied before they become a key, so changing them later does not affect the hash
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+
+	for _, i := range h.buckets[hashKey] {
+		if Equal(h.pairs[i].Key, key) {
+			h.pairs[i].Value = value
+			return
+		}
+	}
+
+	h.buckets[hashKey] = append(h.buckets[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: copyKey(key, map[Object]Object{}), Value: value})
+}
+
+// Pairs returns a copy of the pairs in the order they were added
+func (h *Hash) Pairs() []HashPair {
+	return append([]HashPair{}, h.pairs...)
+}
+
+// HashKey combines keys of the elements, so arrays with Equal elements have the same HashKey
+func (a *Array) HashKey() HashKey {
+	return hashKeyOf(a, map[Object]bool{})
+}
+
+// HashKey does not depend on the order of the pairs, like Equal does not
+func (h *Hash) HashKey() HashKey {
+	return hashKeyOf(h, map[Object]bool{})
+}
+
+// hashKeyOf returns HashKey of any object, so an array of functions can be a key as well.
+// Objects which are only Equal to themselves have the same HashKey, the hash tells them apart with Equal.
+// An array or a hash which contains itself is not hashed again, since it is being hashed already
+func hashKeyOf(obj Object, visiting map[Object]bool) HashKey {
+	switch obj := obj.(type) {
+	case *Array:
+		if visiting[obj] {
+			return HashKey{Type: obj.Type()}
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		h := fnv.New64a()
+		for _, el := range obj.Elements {
+			writeHashKey(h, hashKeyOf(el, visiting))
+		}
+
+		return HashKey{Type: obj.Type(), Value: h.Sum64()}
+	case *Hash:
+		if visiting[obj] {
+			return HashKey{Type: obj.Type()}
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		// the sum does not depend on the order the pairs are added in
+		var sum uint64
+		for _, pair := range obj.Pairs() {
+			h := fnv.New64a()
+			writeHashKey(h, hashKeyOf(pair.Key, visiting))
+			writeHashKey(h, hashKeyOf(pair.Value, visiting))
+			sum += h.Sum64()
+		}
+
+		return HashKey{Type: obj.Type(), Value: sum}
+	case Hashable:
+		return obj.HashKey()
+	default:
+		return HashKey{Type: obj.Type()}
+	}
+}
+
+// numberHashKey is HashKey of integers and floats. Equal compares an integer with a float as float64,
+// so every number is hashed as the same float64 and 1, 1.0 and their big neighbours share a bucket
+func numberHashKey(number Object) HashKey {
+	value, _ := toFloat(number)
+
+	// -0.0 is Equal to 0.0
+	if value == 0 {
+		value = 0
+	}
+
+	return HashKey{Type: INTEGER_OBJ, Value: math.Float64bits(value)}
+}
+
+func writeHashKey(w interface{ Write([]byte) (int, error) }, key HashKey) {
+	w.Write([]byte(key.Type))
+
+	var value [8]byte
+	binary.LittleEndian.PutUint64(value[:], key.Value)
+	w.Write(value[:])
+}
+
+// copyKey copies arrays and hashes deeply, other objects are either immutable or only Equal to themselves.
+// copies maps the original collections to their copies, so a collection which contains itself is copied once
+func copyKey(obj Object, copies map[Object]Object) Object {
+	if c, ok := copies[obj]; ok {
+		return c
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		c := &Array{Elements: make([]Object, len(obj.Elements))}
+		copies[obj] = c
+
+		for i, el := range obj.Elements {
+			c.Elements[i] = copyKey(el, copies)
+		}
+
+		return c
+	case *Hash:
+		c := NewHash()
+		copies[obj] = c
+
+		// the keys are equal to the original ones, so the buckets stay the same
+		for hashKey, bucket := range obj.buckets {
+			c.buckets[hashKey] = append([]int{}, bucket...)
+		}
+		for _, pair := range obj.pairs {
+			c.pairs = append(c.pairs, HashPair{
+				Key:   copyKey(pair.Key, copies),
+				Value: copyKey(pair.Value, copies),
+			})
+		}
+
+		return c
+	default:
+		return obj
+	}
+}
@@ -4,24 +4,39 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/titivuk/go-interpreter/ast"
+	"github.com/titivuk/go-interpreter/code"
+	"github.com/titivuk/go-interpreter/token"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	BIGINT_OBJ       = "BIGINT"
+	FLOAT_OBJ        = "FLOAT"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	BUILTIN_OBJ      = "BUILTINT"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+	CELL_OBJ              = "CELL"
+	ITERATOR_OBJ          = "ITERATOR"
 )
 
 type Object interface {
@@ -34,12 +49,67 @@ type Integer struct {
 }
 
 func (i *Integer) HashKey() HashKey {
-	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+	return numberHashKey(i)
 }
 
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// BigInt is an integer which does not fit into int64.
+// It is created with NewInteger, so integers within int64 range are always Integer
+// and the same number always has the same type
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) HashKey() HashKey {
+	return numberHashKey(b)
+}
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
+// NewInteger returns Integer if value fits into int64, otherwise BigInt
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+
+	return &BigInt{Value: value}
+}
+
+// ToBigInt converts Integer or BigInt to big.Int, it reports false for other objects
+func ToBigInt(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInt:
+		return obj.Value, true
+	default:
+		return nil, false
+	}
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) HashKey() HashKey {
+	return numberHashKey(f)
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect always keeps the fraction, so 2.0 is not confused with the integer 2
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+
+	return s
+}
+
 type String struct {
 	Value string
 }
@@ -73,6 +143,21 @@ func (b *Boolean) HashKey() HashKey {
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 
+// TRUE, FALSE and NULL are shared by both backends and the builtins,
+// the backends tell them apart by pointer, so every boolean and null has to be one of them
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+func NativeBoolToBoolean(native bool) *Boolean {
+	if native {
+		return TRUE
+	}
+	return FALSE
+}
+
 type Null struct{} // null represents the absence if any value
 
 func (n *Null) Type() ObjectType { return NULL_OBJ }
@@ -85,29 +170,160 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break and Continue stop the evaluation of the loop body,
+// they bubble up through block statements to the loop the same way ReturnValue does to the function
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 type Error struct {
 	Message string
+	Pos     token.Position // where in the source the error happened, zero value if unknown
+	Stack   []StackFrame   // function calls the error propagated through, the innermost call first
+	Value   Object         // the value of `throw`, nil for errors raised by the interpreter
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+
+	return "ERROR: " + e.Message
+}
+
+// Traceback is Inspect followed by the call stack of the error
+func (e *Error) Traceback() string {
+	return e.Inspect() + FormatStack(e.Stack)
+}
+
+// NewThrownError creates the error raised by `throw`.
+// Strings become the message as they are and hashes use their "message" entry,
+// so an error caught by `catch` can be thrown again
+func NewThrownError(value Object) *Error {
+	message := value.Inspect()
+	if hash, ok := value.(*Hash); ok {
+		if msg, ok := hash.Get(&String{Value: "message"}); ok {
+			message = msg.Inspect()
+		}
+	}
+
+	return &Error{Message: message, Value: value}
+}
+
+// Hash makes the caught error available to the script as
+// {"message": ..., "position": ..., "stack": [...], "value": ...}
+func (e *Error) Hash() *Hash {
+	stack := &Array{Elements: []Object{}}
+	for _, frame := range e.Stack {
+		stack.Elements = append(stack.Elements, &String{Value: frame.Function + " called at " + frame.Pos.String()})
+	}
+
+	var value Object = NULL
+	if e.Value != nil {
+		value = e.Value
+	}
+
+	hash := NewHash()
+	pairs := []struct {
+		key   string
+		value Object
+	}{
+		{"message", &String{Value: e.Message}},
+		{"position", &String{Value: e.Pos.String()}},
+		{"stack", stack},
+		{"value", value},
+	}
+	for _, pair := range pairs {
+		hash.Set(&String{Value: pair.key}, pair.value)
+	}
+
+	return hash
+}
+
+// StackFrame is a call of the function which was in progress when an error happened
+type StackFrame struct {
+	Function string         // name the function was bound to, ANONYMOUS_FUNCTION for function literals
+	Pos      token.Position // where the function was called
+}
+
+const ANONYMOUS_FUNCTION = "<anonymous>"
+
+// frames at the top and at the bottom of the stack that are shown by FormatStack,
+// the middle of a deep recursion is left out
+const MAX_TRACEBACK_FRAMES = 10
+
+// FormatStack renders the call stack, one call per line, the innermost call first:
+//
+//	Traceback (most recent call first):
+//	  inner called at 4:10
+//	  outer called at 6:1
+//
+// It returns an empty string if there are no calls
+func FormatStack(stack []StackFrame) string {
+	if len(stack) == 0 {
+		return ""
+	}
+
+	var out bytes.Buffer
+	out.WriteString("\nTraceback (most recent call first):")
+
+	for i, frame := range stack {
+		if len(stack) > 2*MAX_TRACEBACK_FRAMES && i == MAX_TRACEBACK_FRAMES {
+			omitted := len(stack) - 2*MAX_TRACEBACK_FRAMES
+			out.WriteString(fmt.Sprintf("\n  ... %d more calls ...", omitted))
+		}
+		if len(stack) > 2*MAX_TRACEBACK_FRAMES && i >= MAX_TRACEBACK_FRAMES && i < len(stack)-MAX_TRACEBACK_FRAMES {
+			continue
+		}
+
+		out.WriteString("\n  " + frame.Function + " called at " + frame.Pos.String())
+	}
+
+	return out.String()
+}
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.callDepth = outer.callDepth
+	return env
+}
+
+// NewCallEnvironment is the environment of a function call, outer is the environment the function is defined in.
+// The call is one level deeper than the caller, no matter where the function is defined
+func NewCallEnvironment(outer, caller *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.callDepth = caller.callDepth + 1
 	return env
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	c := make(map[string]ast.Node)
+	return &Environment{store: s, constants: c, outer: nil}
 }
 
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// names bound by const and the statements that declared them.
+	// Running the same declaration again, e.g. in a loop body, does not redeclare the constant
+	constants map[string]ast.Node
+
+	callDepth int // number of function calls in progress
 }
 
+// CallDepth returns the number of function calls in progress, the evaluator uses it to limit recursion
+func (e *Environment) CallDepth() int { return e.callDepth }
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
@@ -121,16 +337,63 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
+// SetConst binds the name as a constant, decl is the statement that declares it
+func (e *Environment) SetConst(name string, val Object, decl ast.Node) Object {
+	e.store[name] = val
+	e.constants[name] = decl
+	return val
+}
+
+// Const reports whether the name is bound as a constant in this environment, outer ones are not checked.
+// It returns the statement that declared the constant
+func (e *Environment) Const(name string) (ast.Node, bool) {
+	decl, ok := e.constants[name]
+	return decl, ok
+}
+
+// IsConst reports whether the nearest binding of the name is a constant
+func (e *Environment) IsConst(name string) bool {
+	if _, ok := e.store[name]; ok {
+		_, ok := e.constants[name]
+		return ok
+	}
+
+	if e.outer != nil {
+		return e.outer.IsConst(name)
+	}
+
+	return false
+}
+
+// Assign updates the nearest binding of the name, unlike Set it never creates a new one.
+// It reports false if the name is not bound in this or any outer environment
+func (e *Environment) Assign(name string, val Object) bool {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return true
+	}
+
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+
+	return false
+}
+
 func (e *Environment) Copy() *Environment {
 	env := NewEnvironment()
 	for k, v := range e.store {
 		env.Set(k, v)
 	}
+	for k, decl := range e.constants {
+		env.constants[k] = decl
+	}
 
 	return env
 }
 
 type Function struct {
+	Name       string // name of the binding the function was defined with, empty for anonymous functions
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -155,7 +418,83 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
-type BuiltinFunction func(args ...Object) Object
+// Quote is the result of `quote(...)`, it holds the unevaluated AST node
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// CompiledFunction is the bytecode counterpart of Function.
+// It is produced by the compiler and lives in the constant pool
+type CompiledFunction struct {
+	Name          string // name of the binding the function was defined with, empty for anonymous functions
+	Instructions  code.Instructions
+	Positions     map[int]token.Position // source position of the instruction at the given offset
+	NumLocals     int                    // number of local bindings, the vm reserves stack slots for them
+	NumParameters int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure wraps CompiledFunction with the free variables it captured at runtime.
+// The vm only ever calls closures, even if there are no free variables
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Cell holds a variable captured by a closure.
+// The closure and the function the variable is defined in share the cell,
+// so an assignment made by one of them is visible to the other
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return c.Value.Inspect() }
+
+// CallFunction calls a function of the script with the given arguments, builtins use it to call their callbacks.
+// Each backend provides its own, the result is an *Error if the call fails
+type CallFunction func(fn Object, args ...Object) Object
+
+type BuiltinFunction func(call CallFunction, args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
@@ -174,54 +513,114 @@ type Array struct {
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
-func (a *Array) Inspect() string {
-	var out bytes.Buffer
+func (a *Array) Inspect() string  { return inspect(a, map[Object]bool{}) }
 
-	params := []string{}
+// inspect prints arrays and hashes which may contain themselves,
+// an array or a hash that is already being printed becomes [...] or {...}
+func inspect(obj Object, visiting map[Object]bool) string {
+	var out bytes.Buffer
 
-	for _, p := range a.Elements {
-		params = append(params, p.Inspect())
+	switch obj := obj.(type) {
+	case *Array:
+		if visiting[obj] {
+			return "[...]"
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		params := []string{}
+
+		for _, p := range obj.Elements {
+			params = append(params, inspect(p, visiting))
+		}
+
+		out.WriteString("[")
+		out.WriteString(strings.Join(params, ", "))
+		out.WriteString("]")
+	case *Hash:
+		if visiting[obj] {
+			return "{...}"
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		pairs := []string{}
+		for _, pair := range obj.Pairs() {
+			pairs = append(pairs, fmt.Sprintf("%s: %s",
+				inspect(pair.Key, visiting), inspect(pair.Value, visiting)))
+		}
+
+		out.WriteString("{")
+		out.WriteString(strings.Join(pairs, ", "))
+		out.WriteString("}")
+	default:
+		return obj.Inspect()
 	}
 
-	out.WriteString("[")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString("]")
-
 	return out.String()
 }
 
-type Hashable interface {
-	HashKey() HashKey
+// Iterator walks over elements of an array, characters of a string or pairs of a hash.
+// Both the evaluator and the vm use it to run for-in loops
+type Iterator struct {
+	keys   []Object
+	values []Object
+	isHash bool
+	index  int
 }
 
-// comparable struct so we can use it with == and as map key
-type HashKey struct {
-	Type  ObjectType
-	Value uint64
-}
+// NewIterator reports false if obj can not be iterated over.
+// The iterator works on a snapshot, so the loop is not affected by changes of the collection
+func NewIterator(obj Object) (*Iterator, bool) {
+	it := &Iterator{index: -1}
+
+	switch obj := obj.(type) {
+	case *Array:
+		for i, el := range obj.Elements {
+			it.keys = append(it.keys, &Integer{Value: int64(i)})
+			it.values = append(it.values, el)
+		}
+	case *String:
+		i := 0
+		for _, ch := range obj.Value {
+			it.keys = append(it.keys, &Integer{Value: int64(i)})
+			it.values = append(it.values, &String{Value: string(ch)})
+			i++
+		}
+	case *Hash:
+		it.isHash = true
+
+		for _, pair := range obj.Pairs() {
+			it.keys = append(it.keys, pair.Key)
+			it.values = append(it.values, pair.Value)
+		}
+	default:
+		return nil, false
+	}
 
-type HashPair struct {
-	Key   Object
-	Value Object
+	return it, true
 }
 
-type Hash struct {
-	Pairs map[HashKey]HashPair
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// Next moves to the next element, it reports false when there are no elements left
+func (it *Iterator) Next() bool {
+	it.index++
+	return it.index < len(it.keys)
 }
 
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
+// Key is the index of the element or the key of the hash pair
+func (it *Iterator) Key() Object { return it.keys[it.index] }
 
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
-	}
+// Value is the element or the value of the hash pair
+func (it *Iterator) Value() Object { return it.values[it.index] }
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+// Item is what a loop with a single variable gets, i.e. the element or the key of the hash pair
+func (it *Iterator) Item() Object {
+	if it.isHash {
+		return it.Key()
+	}
 
-	return out.String()
+	return it.Value()
 }
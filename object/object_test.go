@@ -1,6 +1,12 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/titivuk/go-interpreter/ast"
+)
 
 func TestStringHashKey(t *testing.T) {
     hello1 := &String{Value: "Hello World"}
@@ -19,4 +25,298 @@ func TestStringHashKey(t *testing.T) {
     if hello1.HashKey() == diff1.HashKey() {
         t.Errorf("strings with different content have same hash keys")
     }
-}
\ No newline at end of file
+}
+func TestBigIntHashKey(t *testing.T) {
+	big1, _ := new(big.Int).SetString("99999999999999999999", 10)
+	big2, _ := new(big.Int).SetString("99999999999999999999", 10)
+	// numbers are hashed as float64, so the different value is further than its precision
+	diff, _ := new(big.Int).SetString("99999999999990000000", 10)
+
+	if NewInteger(big1).(Hashable).HashKey() != NewInteger(big2).(Hashable).HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+
+	if NewInteger(big1).(Hashable).HashKey() == NewInteger(diff).(Hashable).HashKey() {
+		t.Errorf("big integers with different values have same hash keys")
+	}
+
+	// small values are always Integer, so they hash the same way however they were created
+	small := NewInteger(big.NewInt(42))
+	if small.(Hashable).HashKey() != (&Integer{Value: 42}).HashKey() {
+		t.Errorf("NewInteger did not demote small value to Integer, got %T", small)
+	}
+}
+
+func TestNumberHashKey(t *testing.T) {
+	twoTo63, _ := new(big.Int).SetString("9223372036854775808", 10)
+	big20, _ := new(big.Int).SetString("100000000000000000000", 10)
+
+	// numbers which are Equal must have the same hash key whatever their types are
+	tests := [][2]Object{
+		{&Integer{Value: 1}, &Float{Value: 1.0}},
+		{&Float{Value: 0.0}, &Float{Value: math.Copysign(0, -1)}},
+		{&Integer{Value: 1<<53 + 1}, &Float{Value: 1 << 53}},
+		{&Integer{Value: math.MaxInt64}, &Float{Value: 1 << 63}},
+		{NewInteger(twoTo63), &Float{Value: 1 << 63}},
+		{NewInteger(big20), &Float{Value: 1e20}},
+	}
+
+	for _, tt := range tests {
+		if !Equal(tt[0], tt[1]) {
+			t.Fatalf("%s and %s are not equal", tt[0].Inspect(), tt[1].Inspect())
+		}
+
+		if tt[0].(Hashable).HashKey() != tt[1].(Hashable).HashKey() {
+			t.Errorf("%s %s and %s %s have different hash keys", tt[0].Type(), tt[0].Inspect(), tt[1].Type(), tt[1].Inspect())
+		}
+
+		h := NewHash()
+		h.Set(tt[0].(Hashable), &Integer{Value: 1})
+		h.Set(tt[1].(Hashable), &Integer{Value: 2})
+		if value, ok := h.Get(tt[0].(Hashable)); h.Len() != 1 || !ok || value.(*Integer).Value != 2 {
+			t.Errorf("%s and %s are different keys. got=%s", tt[0].Inspect(), tt[1].Inspect(), h.Inspect())
+		}
+	}
+
+	// numbers which only share the nearest float64 collide but stay different keys
+	h := NewHash()
+	h.Set(&Integer{Value: 1<<53 + 1}, &Integer{Value: 1})
+	h.Set(&Integer{Value: 1 << 53}, &Integer{Value: 2})
+	if h.Len() != 2 {
+		t.Errorf("wrong number of pairs. want=2, got=%d", h.Len())
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+
+	inner := NewEnclosedEnvironment(outer)
+	if !inner.Assign("x", &Integer{Value: 2}) {
+		t.Fatalf("assignment to the outer binding failed")
+	}
+
+	if _, ok := inner.store["x"]; ok {
+		t.Errorf("assignment created a binding in the inner environment")
+	}
+
+	if x, _ := outer.Get("x"); x.(*Integer).Value != 2 {
+		t.Errorf("outer binding not updated. got=%s", x.Inspect())
+	}
+
+	if inner.Assign("y", &Integer{Value: 1}) {
+		t.Errorf("assignment to an unbound name succeeded")
+	}
+}
+
+func TestEnvironmentConst(t *testing.T) {
+	decl := &ast.LetStatement{}
+
+	outer := NewEnvironment()
+	outer.SetConst("x", &Integer{Value: 1}, decl)
+
+	inner := NewEnclosedEnvironment(outer)
+	if !inner.IsConst("x") {
+		t.Errorf("x is not a constant in the enclosed environment")
+	}
+
+	if _, ok := inner.Const("x"); ok {
+		t.Errorf("Const must not look into the outer environment")
+	}
+
+	if got, ok := outer.Const("x"); !ok || got != decl {
+		t.Errorf("wrong declaration of x. got=%v", got)
+	}
+
+	// a binding in the inner environment shadows the constant
+	inner.Set("x", &Integer{Value: 2})
+	if inner.IsConst("x") {
+		t.Errorf("shadowing binding is reported as a constant")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash()
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i].(Hashable), pairs[i+1])
+		}
+		return h
+	}
+	array := func(elements ...Object) *Array {
+		return &Array{Elements: elements}
+	}
+	one := &Integer{Value: 1}
+	str := func(s string) *String { return &String{Value: s} }
+	builtin := &Builtin{}
+
+	cyclic1 := array(one)
+	cyclic1.Elements = append(cyclic1.Elements, cyclic1)
+	cyclic2 := array(one)
+	cyclic2.Elements = append(cyclic2.Elements, cyclic2)
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, &Float{Value: 1}, true},
+		{one, &Float{Value: 1.5}, false},
+		{NewInteger(new(big.Int).Lsh(big.NewInt(1), 70)), NewInteger(new(big.Int).Lsh(big.NewInt(1), 70)), true},
+		{one, str("1"), false},
+		{&Boolean{Value: true}, &Boolean{Value: true}, true},
+		{&Null{}, &Null{}, true},
+		{&Null{}, one, false},
+		{array(), array(), true},
+		{array(one, str("a")), array(&Float{Value: 1}, str("a")), true},
+		{array(one, str("a")), array(one, str("b")), false},
+		{array(one), array(one, one), false},
+		{array(array(one), hash(str("k"), array())), array(array(one), hash(str("k"), array())), true},
+		{hash(str("a"), one, str("b"), array(one)), hash(str("b"), array(one), str("a"), one), true},
+		{hash(str("a"), one), hash(str("a"), &Integer{Value: 2}), false},
+		{hash(str("a"), one), hash(str("b"), one), false},
+		{hash(str("a"), one), hash(str("a"), one, str("b"), one), false},
+		{hash(), array(), false},
+		{builtin, builtin, true},
+		{builtin, &Builtin{}, false},
+		{cyclic1, cyclic2, true},
+		{cyclic1, array(one, array(one)), false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d] - Equal(%s, %s) wrong. want=%t, got=%t", i, tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+		if got := Equal(tt.b, tt.a); got != tt.expected {
+			t.Errorf("tests[%d] - Equal is not symmetric for %s and %s", i, tt.a.Inspect(), tt.b.Inspect())
+		}
+	}
+}
+
+func TestCollectionHashKey(t *testing.T) {
+	one := &Integer{Value: 1}
+	str := func(s string) *String { return &String{Value: s} }
+
+	array1 := &Array{Elements: []Object{one, str("a")}}
+	array2 := &Array{Elements: []Object{&Float{Value: 1}, str("a")}}
+	reversed := &Array{Elements: []Object{str("a"), one}}
+
+	if array1.HashKey() != array2.HashKey() {
+		t.Errorf("equal arrays have different hash keys")
+	}
+	if array1.HashKey() == reversed.HashKey() {
+		t.Errorf("arrays with different order of elements have same hash keys")
+	}
+
+	hash1 := NewHash()
+	hash1.Set(str("a"), one)
+	hash1.Set(str("b"), array1)
+	hash2 := NewHash()
+	hash2.Set(str("b"), array2)
+	hash2.Set(str("a"), one)
+
+	if hash1.HashKey() != hash2.HashKey() {
+		t.Errorf("equal hashes have different hash keys")
+	}
+
+	cyclic := &Array{Elements: []Object{one}}
+	cyclic.Elements = append(cyclic.Elements, cyclic)
+	if cyclic.HashKey() == array1.HashKey() {
+		t.Errorf("different arrays have same hash keys")
+	}
+}
+
+func TestHashCollisions(t *testing.T) {
+	// functions are only equal to themselves, so arrays of different functions share the hash key but are different keys
+	fn1 := &Array{Elements: []Object{&Builtin{}}}
+	fn2 := &Array{Elements: []Object{&Builtin{}}}
+	if fn1.HashKey() != fn2.HashKey() {
+		t.Fatalf("expected arrays of functions to collide")
+	}
+
+	h := NewHash()
+	h.Set(fn1, &Integer{Value: 1})
+	h.Set(fn2, &Integer{Value: 2})
+
+	if h.Len() != 2 {
+		t.Fatalf("wrong number of pairs. want=2, got=%d", h.Len())
+	}
+
+	for i, key := range []*Array{fn1, fn2} {
+		value, ok := h.Get(key)
+		if !ok {
+			t.Fatalf("no value for key %d", i)
+		}
+		if value.(*Integer).Value != int64(i+1) {
+			t.Errorf("wrong value for key %d. got=%s", i, value.Inspect())
+		}
+	}
+
+	// setting an equal key replaces the value
+	h.Set(&Array{Elements: fn1.Elements}, &Integer{Value: 3})
+	if value, _ := h.Get(fn1); h.Len() != 2 || value.(*Integer).Value != 3 {
+		t.Errorf("equal key did not replace the value. got=%s", h.Inspect())
+	}
+}
+
+func TestHashKeyIsCopied(t *testing.T) {
+	key := &Array{Elements: []Object{&Integer{Value: 1}}}
+
+	h := NewHash()
+	h.Set(key, &String{Value: "x"})
+	key.Elements = append(key.Elements, &Integer{Value: 2})
+
+	if _, ok := h.Get(&Array{Elements: []Object{&Integer{Value: 1}}}); !ok {
+		t.Errorf("mutating the key changed the hash")
+	}
+	if _, ok := h.Get(key); ok {
+		t.Errorf("mutated key is found in the hash")
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	h := NewHash()
+	for i, key := range []string{"c", "a", "b"} {
+		h.Set(&String{Value: key}, &Integer{Value: int64(i)})
+	}
+	// replacing the value keeps the position of the pair
+	h.Set(&String{Value: "c"}, &Integer{Value: 3})
+
+	if h.Inspect() != "{c: 3, a: 1, b: 2}" {
+		t.Errorf("wrong Inspect. got=%q", h.Inspect())
+	}
+
+	it, _ := NewIterator(h)
+	keys := ""
+	for it.Next() {
+		keys += it.Key().Inspect()
+	}
+	if keys != "cab" {
+		t.Errorf("wrong iteration order. got=%q", keys)
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	arr := &Array{Elements: []Object{&Integer{Value: 1}}}
+	arr.Elements = append(arr.Elements, arr)
+
+	h := NewHash()
+	h.Set(&String{Value: "self"}, h)
+	h.Set(&String{Value: "arr"}, arr)
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{arr, "[1, [...]]"},
+		{h, "{self: {...}, arr: [1, [...]]}"},
+		// an array seen twice without a cycle is printed in full
+		{&Array{Elements: []Object{arr, arr}}, "[[1, [...]], [1, [...]]]"},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect. expected=%q, got=%q", tt.expected, tt.obj.Inspect())
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/titivuk/go-interpreter/token"
+)
+
+// operators of the language are implemented here, so the evaluator and the vm can not disagree on them.
+// The backends only report the *Error results their own way, a nil result is null
+
+// BinaryOperation applies the infix operator to the operands, e.g. `left + right`
+func BinaryOperation(left Object, operator string, right Object) Object {
+	switch {
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+		return integerOperation(left.(*Integer), operator, right.(*Integer))
+	case isInteger(left) && isInteger(right):
+		return bigIntOperation(left, operator, right)
+	case isNumber(left) && isNumber(right):
+		// at least one of the operands is float, so the integer one is converted to float
+		return floatOperation(left, operator, right)
+	case operator == token.ASTERISK && left.Type() == STRING_OBJ && right.Type() == INTEGER_OBJ:
+		return repeatString(left.(*String), right.(*Integer))
+	case operator == token.ASTERISK && left.Type() == INTEGER_OBJ && right.Type() == STRING_OBJ:
+		return repeatString(right.(*String), left.(*Integer))
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case left.Type() == STRING_OBJ:
+		return stringOperation(left.(*String), operator, right.(*String))
+	case left.Type() == BOOLEAN_OBJ:
+		return booleanOperation(left.(*Boolean), operator, right.(*Boolean))
+	case left.Type() == ARRAY_OBJ || left.Type() == HASH_OBJ:
+		return collectionOperation(left, operator, right)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// Negate is the prefix minus
+func Negate(operand Object) Object {
+	switch operand := operand.(type) {
+	case *Integer:
+		if operand.Value == math.MinInt64 {
+			return NewInteger(new(big.Int).Neg(big.NewInt(operand.Value)))
+		}
+		return &Integer{Value: -operand.Value}
+	case *BigInt:
+		return NewInteger(new(big.Int).Neg(operand.Value))
+	case *Float:
+		return &Float{Value: -operand.Value}
+	default:
+		return newError("unknown operator: -%s", operand.Type())
+	}
+}
+
+func integerOperation(left *Integer, operator string, right *Integer) Object {
+	leftValue := left.Value
+	rightValue := right.Value
+
+	// on overflow the operation is repeated with big integers
+	switch operator {
+	case token.PLUS:
+		result := leftValue + rightValue
+		if (leftValue^result)&(rightValue^result) < 0 {
+			return bigIntOperation(left, operator, right)
+		}
+		return &Integer{Value: result}
+	case token.MINUS:
+		result := leftValue - rightValue
+		if (leftValue^rightValue)&(leftValue^result) < 0 {
+			return bigIntOperation(left, operator, right)
+		}
+		return &Integer{Value: result}
+	case token.ASTERISK:
+		result := leftValue * rightValue
+		if leftValue != 0 && (result/leftValue != rightValue || leftValue == -1 && rightValue == math.MinInt64) {
+			return bigIntOperation(left, operator, right)
+		}
+		return &Integer{Value: result}
+	case token.SLASH:
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		if leftValue == math.MinInt64 && rightValue == -1 {
+			return bigIntOperation(left, operator, right)
+		}
+		return &Integer{Value: leftValue / rightValue}
+	case token.PERCENT:
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		// the result has the sign of the dividend, MinInt64 % -1 is 0
+		return &Integer{Value: leftValue % rightValue}
+	case token.LT:
+		return NativeBoolToBoolean(leftValue < rightValue)
+	case token.GT:
+		return NativeBoolToBoolean(leftValue > rightValue)
+	case token.LT_EQ:
+		return NativeBoolToBoolean(leftValue <= rightValue)
+	case token.GT_EQ:
+		return NativeBoolToBoolean(leftValue >= rightValue)
+	case token.EQ:
+		return NativeBoolToBoolean(leftValue == rightValue)
+	case token.NOT_EQ:
+		return NativeBoolToBoolean(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// bigIntOperation is used when one of the operands is BigInt or int64 arithmetic overflows
+func bigIntOperation(left Object, operator string, right Object) Object {
+	leftValue, _ := ToBigInt(left)
+	rightValue, _ := ToBigInt(right)
+
+	switch operator {
+	case token.PLUS:
+		return NewInteger(new(big.Int).Add(leftValue, rightValue))
+	case token.MINUS:
+		return NewInteger(new(big.Int).Sub(leftValue, rightValue))
+	case token.ASTERISK:
+		return NewInteger(new(big.Int).Mul(leftValue, rightValue))
+	case token.SLASH:
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		// Quo truncates towards zero the same way int64 division does
+		return NewInteger(new(big.Int).Quo(leftValue, rightValue))
+	case token.PERCENT:
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		// Rem is the counterpart of Quo, the result has the sign of the dividend
+		return NewInteger(new(big.Int).Rem(leftValue, rightValue))
+	case token.LT:
+		return NativeBoolToBoolean(leftValue.Cmp(rightValue) < 0)
+	case token.GT:
+		return NativeBoolToBoolean(leftValue.Cmp(rightValue) > 0)
+	case token.LT_EQ:
+		return NativeBoolToBoolean(leftValue.Cmp(rightValue) <= 0)
+	case token.GT_EQ:
+		return NativeBoolToBoolean(leftValue.Cmp(rightValue) >= 0)
+	case token.EQ:
+		return NativeBoolToBoolean(leftValue.Cmp(rightValue) == 0)
+	case token.NOT_EQ:
+		return NativeBoolToBoolean(leftValue.Cmp(rightValue) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func floatOperation(left Object, operator string, right Object) Object {
+	leftValue, _ := toFloat(left)
+	rightValue, _ := toFloat(right)
+
+	switch operator {
+	case token.PLUS:
+		return &Float{Value: leftValue + rightValue}
+	case token.MINUS:
+		return &Float{Value: leftValue - rightValue}
+	case token.ASTERISK:
+		return &Float{Value: leftValue * rightValue}
+	case token.SLASH:
+		return &Float{Value: leftValue / rightValue}
+	case token.PERCENT:
+		return &Float{Value: math.Mod(leftValue, rightValue)}
+	case token.LT:
+		return NativeBoolToBoolean(leftValue < rightValue)
+	case token.GT:
+		return NativeBoolToBoolean(leftValue > rightValue)
+	case token.LT_EQ:
+		return NativeBoolToBoolean(leftValue <= rightValue)
+	case token.GT_EQ:
+		return NativeBoolToBoolean(leftValue >= rightValue)
+	case token.EQ:
+		return NativeBoolToBoolean(leftValue == rightValue)
+	case token.NOT_EQ:
+		return NativeBoolToBoolean(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func stringOperation(left *String, operator string, right *String) Object {
+	leftValue := left.Value
+	rightValue := right.Value
+
+	// strings are ordered by code points, since UTF-8 preserves their order
+	switch operator {
+	case token.PLUS:
+		return &String{Value: leftValue + rightValue}
+	case token.EQ:
+		return NativeBoolToBoolean(leftValue == rightValue)
+	case token.NOT_EQ:
+		return NativeBoolToBoolean(leftValue != rightValue)
+	case token.LT:
+		return NativeBoolToBoolean(leftValue < rightValue)
+	case token.GT:
+		return NativeBoolToBoolean(leftValue > rightValue)
+	case token.LT_EQ:
+		return NativeBoolToBoolean(leftValue <= rightValue)
+	case token.GT_EQ:
+		return NativeBoolToBoolean(leftValue >= rightValue)
+	case token.IN_OPERATOR:
+		return NativeBoolToBoolean(strings.Contains(rightValue, leftValue))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// MaxRepeatLength is the length in bytes a string can be repeated to and the number of elements range makes,
+// a huge count would otherwise run the whole process out of memory
+const MaxRepeatLength = 1 << 26
+
+// repeatString is both `"ab" * 3` and `3 * "ab"`
+func repeatString(str *String, count *Integer) Object {
+	if count.Value < 0 {
+		return newError("negative repeat count: %d", count.Value)
+	}
+
+	if len(str.Value) > 0 && count.Value > MaxRepeatLength/int64(len(str.Value)) {
+		return newError("repeat count too large: %d", count.Value)
+	}
+
+	return &String{Value: strings.Repeat(str.Value, int(count.Value))}
+}
+
+func booleanOperation(left *Boolean, operator string, right *Boolean) Object {
+	// booleans are compared by value, so a boolean does not have to be one of TRUE and FALSE
+	switch operator {
+	case token.EQ:
+		return NativeBoolToBoolean(left.Value == right.Value)
+	case token.NOT_EQ:
+		return NativeBoolToBoolean(left.Value != right.Value)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// collectionOperation compares arrays or hashes structurally, see Equal
+func collectionOperation(left Object, operator string, right Object) Object {
+	switch operator {
+	case token.EQ:
+		return NativeBoolToBoolean(Equal(left, right))
+	case token.NOT_EQ:
+		return NativeBoolToBoolean(!Equal(left, right))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// Index is `left[index]`, an index out of range or a missing key gives null
+func Index(left, index Object) Object {
+	switch {
+	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
+		elements := left.(*Array).Elements
+		i := absoluteIndex(index.(*Integer).Value, len(elements))
+
+		if i < 0 || i >= int64(len(elements)) {
+			return nil
+		}
+
+		return elements[i]
+	case left.Type() == STRING_OBJ && index.Type() == INTEGER_OBJ:
+		// strings are indexed by characters, the result is a string of a single character
+		runes := []rune(left.(*String).Value)
+		i := absoluteIndex(index.(*Integer).Value, len(runes))
+
+		if i < 0 || i >= int64(len(runes)) {
+			return nil
+		}
+
+		return &String{Value: string(runes[i])}
+	case left.Type() == HASH_OBJ:
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		value, ok := left.(*Hash).Get(key)
+		if !ok {
+			return nil
+		}
+
+		return value
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// SetIndex is `left[index] = value`, it updates the array or the hash in place and returns the value
+func SetIndex(left, index, value Object) Object {
+	switch {
+	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
+		elements := left.(*Array).Elements
+		i := absoluteIndex(index.(*Integer).Value, len(elements))
+
+		if i < 0 || i >= int64(len(elements)) {
+			return newError("index out of range: %d", index.(*Integer).Value)
+		}
+
+		elements[i] = value
+	case left.Type() == HASH_OBJ:
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		left.(*Hash).Set(key, value)
+	default:
+		return newError("index assignment not supported: %s[%s]", left.Type(), index.Type())
+	}
+
+	return value
+}
+
+// absoluteIndex converts a negative index, which counts from the end, e.g. -1 is the last element
+func absoluteIndex(i int64, length int) int64 {
+	if i < 0 {
+		return i + int64(length)
+	}
+
+	return i
+}
+
+// Slice is `left[start:end]`, an omitted bound is null.
+// It copies the elements or the characters between the bounds, so the slice is never shared
+func Slice(left, start, end Object) Object {
+	switch left := left.(type) {
+	case *Array:
+		from, to, err := sliceBounds(start, end, len(left.Elements))
+		if err != nil {
+			return err
+		}
+
+		elements := make([]Object, to-from)
+		copy(elements, left.Elements[from:to])
+
+		return &Array{Elements: elements}
+	case *String:
+		runes := []rune(left.Value)
+
+		from, to, err := sliceBounds(start, end, len(runes))
+		if err != nil {
+			return err
+		}
+
+		return &String{Value: string(runes[from:to])}
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+}
+
+// sliceBounds converts the bounds to indexes within [0, length], like Python does.
+// Out of range bounds are clamped, so the slice may be empty, but it is never an error
+func sliceBounds(start, end Object, length int) (int, int, *Error) {
+	from, err := sliceBound(start, 0, length)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	to, err := sliceBound(end, length, length)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if to < from {
+		to = from
+	}
+
+	return from, to, nil
+}
+
+// sliceBound returns def for null
+func sliceBound(bound Object, def, length int) (int, *Error) {
+	switch bound := bound.(type) {
+	case *Null:
+		return def, nil
+	case *Integer:
+		i := absoluteIndex(bound.Value, length)
+		if i < 0 {
+			return 0, nil
+		}
+
+		if i > int64(length) {
+			return length, nil
+		}
+
+		return int(i), nil
+	default:
+		return 0, newError("slice index must be INTEGER, got %s", bound.Type())
+	}
+}
+
+func isInteger(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == BIGINT_OBJ
+}
+
+func isNumber(obj Object) bool {
+	return isInteger(obj) || obj.Type() == FLOAT_OBJ
+}
@@ -0,0 +1,110 @@
+package object
+
+import (
+	"fmt"
+
+	"github.com/titivuk/go-interpreter/ast"
+	"github.com/titivuk/go-interpreter/token"
+)
+
+// unquote calls are spliced into the quoted code here, so the evaluator and the vm build the same code
+
+// IsUnquoteCall reports whether the node is `unquote(...)`
+func IsUnquoteCall(node ast.Node) bool {
+	callExpression, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	return callExpression.Function.TokenLiteral() == "unquote"
+}
+
+// UnquoteCalls returns the unquote calls of the quoted code in the order ast.Modify visits them,
+// their arguments are evaluated in this order
+func UnquoteCalls(quoted ast.Node) []*ast.CallExpression {
+	calls := []*ast.CallExpression{}
+
+	ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if IsUnquoteCall(node) {
+			calls = append(calls, node.(*ast.CallExpression))
+		}
+		return node
+	})
+
+	return calls
+}
+
+// Unquote replaces the unquote calls of the quoted code with the values of their arguments,
+// the values come in the order of UnquoteCalls
+func Unquote(quoted ast.Node, values []Object) (ast.Node, *Error) {
+	var err *Error
+	i := 0
+
+	node := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if err != nil || !IsUnquoteCall(node) || i >= len(values) {
+			return node
+		}
+
+		call := node.(*ast.CallExpression)
+		value := values[i]
+		i++
+
+		converted := ToNode(value, call.Token.Pos)
+		if converted == nil {
+			err = newError("cannot unquote %s", value.Type())
+			err.Pos = call.Pos()
+			return node
+		}
+
+		return converted
+	})
+
+	return node, err
+}
+
+// ToNode turns the value back into code, it returns nil if the value has no literal.
+// Generated nodes point at pos, i.e. at the unquote call they replace
+func ToNode(obj Object, pos token.Position) ast.Node {
+	switch obj := obj.(type) {
+	case *Integer:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: fmt.Sprintf("%d", obj.Value),
+			Pos:     pos,
+		}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+	case *BigInt:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: obj.Value.String(),
+			Pos:     pos,
+		}
+		return &ast.IntegerLiteral{Token: t, Big: obj.Value}
+	case *Float:
+		t := token.Token{
+			Type:    token.FLOAT,
+			Literal: obj.Inspect(),
+			Pos:     pos,
+		}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}
+	case *String:
+		t := token.Token{
+			Type:    token.STRING,
+			Literal: obj.Value,
+			Pos:     pos,
+		}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+	case *Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false", Pos: pos}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}
+	case *Quote:
+		return obj.Node
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/titivuk/go-interpreter/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Span is a range of the source, End points right after the last char of the range
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// Diagnostic describes a problem the parser found in the source.
+// Expected and Actual are empty when the problem is not about an unexpected token
+type Diagnostic struct {
+	Severity Severity
+	Span     Span
+	Expected token.TokenType
+	Actual   token.TokenType
+	Message  string
+}
+
+// String returns diagnostic in the "line:column: severity: message" form
+func (d Diagnostic) String() string {
+	if d.Span.Start.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", d.Span.Start, d.Severity, d.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
+
+// tokenSpan returns the range the token occupies in the source
+func tokenSpan(tok token.Token) Span {
+	return Span{Start: tok.Pos, End: tok.End}
+}
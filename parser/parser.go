@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"github.com/titivuk/go-interpreter/ast"
@@ -17,8 +19,13 @@ type (
 const (
 	_ int = iota // use iota to give the following constants incrementing numbers as values
 	LOWEST
+	ASSIGN      // = or +=
+	TERNARY     // c ? a : b
+	NULLISH     // ??
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
-	LESSGREATER // > or <
+	LESSGREATER // > or <=
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
@@ -31,12 +38,28 @@ var precedences = map[token.TokenType]int{
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
+	token.IN:       LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.ASTERISK: PRODUCT,
 	token.SLASH:    PRODUCT,
+	token.PERCENT:  PRODUCT,
+	token.AND:      LOGICAL_AND,
+	token.OR:       LOGICAL_OR,
+	token.QUESTION: TERNARY,
+	token.NULLISH:  NULLISH,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+
+	token.OPTIONAL_CHAIN: INDEX,
 }
 
 type Parser struct {
@@ -48,16 +71,42 @@ type Parser struct {
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 
-	errors []string
+	errors []Diagnostic
+
+	// panicking is set once the current statement has an error.
+	// Errors are not recorded until the parser skips to the next statement,
+	// because everything after the first error in a statement is usually a consequence of it
+	panicking bool
+
+	// loopDepth is the number of loops around the current statement within the current function,
+	// break and continue are only allowed inside of a loop
+	loopDepth int
+	// inValue is set inside of an expression whose value is used, e.g. `[if (c) { break; }]`.
+	// break and continue are not allowed there, they would leave the rest of the expression unfinished
+	inValue bool
+	// statementIf is set right before an if or try that starts an expression statement,
+	// its blocks are statements of the surrounding block, unless the if turns out to be an operand
+	statementIf bool
+	// loopControl is the first break or continue of the current loop body parsed within the current statement
+	loopControl *token.Token
+
+	// Strict makes declaring the same name twice in a scope an error
+	Strict bool
+	// names declared in each of the scopes around the current statement, only tracked in strict mode.
+	// The program, function bodies and catch blocks get a scope, other blocks share the scope around them
+	// the same way they share the environment when the code runs
+	declarations []map[string]bool
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []Diagnostic{}}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefixFn(token.IDENT, p.parseIdentifier)
 	p.registerPrefixFn(token.INT, p.parseIntegerLiteral)
+	p.registerPrefixFn(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefixFn(token.STRING, p.parseStringLiteral)
+	p.registerPrefixFn(token.TEMPLATE_START, p.parseTemplateLiteral)
 	p.registerPrefixFn(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixFn(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefixFn(token.TRUE, p.parseBoolean)
@@ -67,6 +116,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefixFn(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefixFn(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefixFn(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefixFn(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefixFn(token.TRY, p.parseTryExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfixFn(token.EQ, p.parseInfixExpression)
@@ -77,8 +128,22 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfixFn(token.MINUS, p.parseInfixExpression)
 	p.registerInfixFn(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfixFn(token.SLASH, p.parseInfixExpression)
+	p.registerInfixFn(token.PERCENT, p.parseInfixExpression)
+	p.registerInfixFn(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfixFn(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfixFn(token.IN, p.parseInfixExpression)
+	p.registerInfixFn(token.AND, p.parseInfixExpression)
+	p.registerInfixFn(token.OR, p.parseInfixExpression)
 	p.registerInfixFn(token.LPAREN, p.parseCallExpression)
 	p.registerInfixFn(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfixFn(token.OPTIONAL_CHAIN, p.parseOptionalIndexExpression)
+	p.registerInfixFn(token.QUESTION, p.parseConditionalExpression)
+	p.registerInfixFn(token.NULLISH, p.parseInfixExpression)
+	p.registerInfixFn(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.SLASH_ASSIGN, p.parseAssignExpression)
 
 	// Read two tokens, so currToken and peekToken are both set
 	p.nextToken()
@@ -91,10 +156,16 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
+	p.enterScope()
+	defer p.leaveScope()
+
 	// parse until we reach the end
 	for !p.currTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			// the statement is broken, skip the rest of it and continue with the next one
+			p.synchronize()
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
@@ -103,14 +174,46 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []Diagnostic {
 	return p.errors
 }
 
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(Diagnostic{
+		Span:     tokenSpan(p.peekToken),
+		Expected: t,
+		Actual:   p.peekToken.Type,
+		Message:  msg,
+	})
+}
+
+// addError records the diagnostic unless the current statement already has an error
+func (p *Parser) addError(d Diagnostic) {
+	if p.panicking {
+		return
+	}
+
+	d.Severity = SeverityError
+	p.errors = append(p.errors, d)
+	p.panicking = true
+}
+
+// synchronize skips tokens until the end of the broken statement.
+// It stops on the semicolon or right before the token that starts a new statement or closes a block,
+// so the caller can advance to the next statement the usual way
+func (p *Parser) synchronize() {
+	p.panicking = false
+
+	for !p.currTokenIs(token.SEMICOLON) && !p.currTokenIs(token.EOF) {
+		switch p.peekToken.Type {
+		case token.LET, token.CONST, token.RETURN, token.THROW, token.WHILE, token.FOR, token.RBRACE, token.EOF:
+			return
+		}
+
+		p.nextToken()
+	}
 }
 
 func (p *Parser) registerPrefixFn(tokenTpye token.TokenType, fn prefixParseFn) {
@@ -124,14 +227,40 @@ func (p *Parser) registerInfixFn(tokenType token.TokenType, fn infixParseFn) {
 func (p *Parser) nextToken() {
 	p.currToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// the lexer reports malformed input with ERROR tokens, we record them and skip them.
+	// A malformed string is followed by the string itself, so one error gives one diagnostic
+	for p.peekTokenIs(token.ERROR) {
+		p.lexerError(p.peekToken)
+		p.peekToken = p.l.NextToken()
+	}
+}
+
+func (p *Parser) lexerError(tok token.Token) {
+	// lexer errors are not a consequence of other errors, so they are recorded even in the panic mode.
+	// The parser does not panic either, since the erroneous token is skipped
+	p.errors = append(p.errors, Diagnostic{
+		Severity: SeverityError,
+		Span:     tokenSpan(tok),
+		Actual:   tok.Type,
+		Message:  tok.Literal,
+	})
 }
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -146,6 +275,10 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	}
 	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
+	if !p.declare(stmt.Name) {
+		return nil
+	}
+
 	// next token must be ASSIGN
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -155,6 +288,11 @@ func (p *Parser) parseLetStatement() ast.Statement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// let the function know its own name, the compiler needs it to resolve recursive calls
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -162,6 +300,39 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	return stmt
 }
 
+func (p *Parser) enterScope() {
+	if p.Strict {
+		p.declarations = append(p.declarations, map[string]bool{})
+	}
+}
+
+func (p *Parser) leaveScope() {
+	if p.Strict {
+		p.declarations = p.declarations[:len(p.declarations)-1]
+	}
+}
+
+// declare records the name in the current scope.
+// In strict mode it reports false if the scope has declared the name already
+func (p *Parser) declare(name *ast.Identifier) bool {
+	if !p.Strict || len(p.declarations) == 0 {
+		return true
+	}
+
+	scope := p.declarations[len(p.declarations)-1]
+	if scope[name.Value] {
+		p.addError(Diagnostic{
+			Span:    tokenSpan(name.Token),
+			Actual:  name.Token.Type,
+			Message: fmt.Sprintf("%s is already declared in this scope", name.Value),
+		})
+		return false
+	}
+
+	scope[name.Value] = true
+	return true
+}
+
 func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.currToken}
 
@@ -176,11 +347,168 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.currToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variables = append(stmt.Variables, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Variables = append(stmt.Variables, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseLoopBody parses the block where break and continue are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	outerInValue, outerLoopControl := p.inValue, p.loopControl
+	p.loopDepth++
+	p.inValue = false
+	defer func() {
+		p.loopDepth--
+		p.inValue, p.loopControl = outerInValue, outerLoopControl
+	}()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	var stmt ast.Statement
+	if p.currTokenIs(token.BREAK) {
+		stmt = &ast.BreakStatement{Token: p.currToken}
+	} else {
+		stmt = &ast.ContinueStatement{Token: p.currToken}
+	}
+
+	if p.loopDepth == 0 {
+		p.addError(Diagnostic{
+			Span:    tokenSpan(p.currToken),
+			Actual:  p.currToken.Type,
+			Message: fmt.Sprintf("%s outside of loop", p.currToken.Literal),
+		})
+		return nil
+	}
+
+	if p.inValue {
+		p.loopControlInValueError(p.currToken)
+		return nil
+	}
+	if p.loopControl == nil {
+		tok := p.currToken
+		p.loopControl = &tok
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) loopControlInValueError(tok token.Token) {
+	p.addError(Diagnostic{
+		Span:    tokenSpan(tok),
+		Actual:  tok.Type,
+		Message: fmt.Sprintf("%s can not be used inside of an expression", tok.Literal),
+	})
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.currToken}
 
+	outerLoopControl := p.loopControl
+	p.loopControl = nil
+	p.statementIf = p.currTokenIs(token.IF) || p.currTokenIs(token.TRY)
+
 	stmt.Expression = p.parseExpression(LOWEST)
 
+	// `if (c) { break; } + 1` uses the value of the if after all
+	switch stmt.Expression.(type) {
+	case *ast.IfExpression, *ast.TryExpression:
+	default:
+		if p.loopControl != nil {
+			p.loopControlInValueError(*p.loopControl)
+			return nil
+		}
+	}
+	if p.loopControl == nil {
+		p.loopControl = outerLoopControl
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -189,6 +517,18 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 }
 
+// enterValue is called by if and try, their blocks are a part of an expression
+// unless they are the expression statement themselves. It returns the function that restores the outer state
+func (p *Parser) enterValue() func() {
+	outerInValue := p.inValue
+	if !p.statementIf {
+		p.inValue = true
+	}
+	p.statementIf = false
+
+	return func() { p.inValue = outerInValue }
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.currToken.Type]
 	if prefix == nil {
@@ -218,7 +558,15 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	if t == token.ILLEGAL {
+		msg = fmt.Sprintf("illegal character %q", p.currToken.Literal)
+	}
+
+	p.addError(Diagnostic{
+		Span:    tokenSpan(p.currToken),
+		Actual:  t,
+		Message: msg,
+	})
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
@@ -227,19 +575,81 @@ func (p *Parser) parseIdentifier() ast.Expression {
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		// the literal is too big for int64, it becomes a big integer
+		if bigValue, ok := new(big.Int).SetString(p.currToken.Literal, 0); ok {
+			return &ast.IntegerLiteral{Token: p.currToken, Big: bigValue}
+		}
+	}
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.currToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(Diagnostic{
+			Span:    tokenSpan(p.currToken),
+			Actual:  p.currToken.Type,
+			Message: msg,
+		})
 		return nil
 	}
 
 	return &ast.IntegerLiteral{Token: p.currToken, Value: value}
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	value, err := strconv.ParseFloat(p.currToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.currToken.Literal)
+		p.addError(Diagnostic{
+			Span:    tokenSpan(p.currToken),
+			Actual:  p.currToken.Type,
+			Message: msg,
+		})
+		return nil
+	}
+
+	return &ast.FloatLiteral{Token: p.currToken, Value: value}
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
 }
 
+// parseTemplateLiteral parses "a ${x} b ${y} c", which the lexer splits into
+// TEMPLATE_START(a ), x, TEMPLATE_MIDDLE( b ), y and TEMPLATE_END( c)
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	template := &ast.TemplateLiteral{
+		Token:   p.currToken,
+		Strings: []string{p.currToken.Literal},
+	}
+
+	for !p.currTokenIs(token.TEMPLATE_END) {
+		if p.peekTokenIs(token.TEMPLATE_MIDDLE) || p.peekTokenIs(token.TEMPLATE_END) {
+			p.addError(Diagnostic{
+				Span:    tokenSpan(p.peekToken),
+				Actual:  p.peekToken.Type,
+				Message: "empty interpolation",
+			})
+			return nil
+		}
+
+		p.nextToken()
+		template.Expressions = append(template.Expressions, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.TEMPLATE_MIDDLE) && !p.peekTokenIs(token.TEMPLATE_END) {
+			p.addError(Diagnostic{
+				Span:    tokenSpan(p.peekToken),
+				Actual:  p.peekToken.Type,
+				Message: fmt.Sprintf("expected } after interpolated expression, got %s instead", p.peekToken.Type),
+			})
+			return nil
+		}
+
+		p.nextToken()
+		template.Strings = append(template.Strings, p.currToken.Literal)
+	}
+
+	return template
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.currToken, Value: p.currTokenIs(token.TRUE)}
 }
@@ -268,6 +678,43 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression parses the value with the lowest precedence,
+// so assignment is right associative, i.e. `a = b = 1` is `a = (b = 1)`
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.currToken,
+		Operator: p.currToken.Literal,
+		Target:   left,
+	}
+
+	if !isAssignable(left) {
+		p.addError(Diagnostic{
+			Span:    tokenSpan(p.currToken),
+			Actual:  p.currToken.Type,
+			Message: fmt.Sprintf("cannot assign to %s", left.String()),
+		})
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
+// isAssignable reports whether the expression can be the target of an assignment
+func isAssignable(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return true
+	case *ast.IndexExpression:
+		// `a?.[k] = v` would have nothing to assign to if a is null
+		return !exp.Optional
+	default:
+		return false
+	}
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -284,6 +731,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.currToken}
+	defer p.enterValue()()
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
@@ -318,6 +766,66 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.currToken}
+	defer p.enterValue()()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.CatchParam = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		// the catch parameter lives in its own environment together with the block
+		p.enterScope()
+		expression.Catch = p.parseBlockStatement()
+		p.leaveScope()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	// try alone would swallow nothing, so one of the clauses is required
+	if expression.Catch == nil && expression.Finally == nil {
+		p.addError(Diagnostic{
+			Span:     tokenSpan(p.peekToken),
+			Expected: token.CATCH,
+			Actual:   p.peekToken.Type,
+			Message:  fmt.Sprintf("expected catch or finally after try block, got %s instead", p.peekToken.Type),
+		})
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currToken}
 	block.Statements = []ast.Statement{}
@@ -326,7 +834,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	for !p.currTokenIs(token.RBRACE) && !p.currTokenIs(token.EOF) {
 		statement := p.parseStatement()
-		if statement != nil {
+		if p.panicking {
+			p.synchronize()
+		} else if statement != nil {
 			block.Statements = append(block.Statements, statement)
 		}
 
@@ -350,7 +860,38 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	expression.Body = p.parseBlockStatement()
+	expression.Body = p.parseFunctionBody()
+
+	return expression
+}
+
+// parseFunctionBody parses the body of a function or a macro, the body is a scope of its own.
+// Loops around the function do not let break and continue escape from it
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	outerLoopDepth, outerInValue, outerLoopControl := p.loopDepth, p.inValue, p.loopControl
+	p.loopDepth, p.inValue = 0, false
+	defer func() { p.loopDepth, p.inValue, p.loopControl = outerLoopDepth, outerInValue, outerLoopControl }()
+
+	p.enterScope()
+	defer p.leaveScope()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	expression := &ast.MacroLiteral{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	expression.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Body = p.parseFunctionBody()
 
 	return expression
 }
@@ -405,7 +946,7 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 func (p *Parser) parseHashLiteral() ast.Expression {
 	// {<expression> : <expression>, <expression> : <expression>, ... }
 	hash := &ast.HashLiteral{Token: p.currToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Pairs = []ast.HashPair{}
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken() // key expresssion pos
@@ -419,7 +960,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 		value := p.parseExpression(LOWEST) // value expression pos
 
-		hash.Pairs[key] = value
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 
 		// order matters
 		// if it's not RBRACE then it must be COMMA
@@ -468,22 +1009,98 @@ func (p *Parser) parseExpressionList(endToken token.TokenType) []ast.Expression
 	return expressions
 }
 
+// parseIndexExpression parses `left[index]` and `left[start:end]`, where either bound of the slice may be omitted
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	indexExpression := &ast.IndexExpression{
-		Token: p.currToken,
+	tok := p.currToken
+
+	var index ast.Expression
+
+	p.nextToken()
+	if !p.currTokenIs(token.COLON) {
+		index = p.parseExpression(LOWEST)
+
+		if !p.peekTokenIs(token.COLON) {
+			if !p.expectPeek(token.RBRACKET) {
+				return nil
+			}
+
+			return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+		}
+
+		p.nextToken()
+	}
+
+	sliceExpression := &ast.SliceExpression{
+		Token: tok,
 		Left:  left,
+		Start: index,
 	}
 
-	p.nextToken()
-	indexExpression.Index = p.parseExpression(LOWEST)
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		sliceExpression.End = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 
+	return sliceExpression
+}
+
+// parseOptionalIndexExpression parses `a?.[k]` and `a?.field`, the latter is a shorthand for `a?.["field"]`
+func (p *Parser) parseOptionalIndexExpression(left ast.Expression) ast.Expression {
+	indexExpression := &ast.IndexExpression{
+		Token:    p.currToken,
+		Left:     left,
+		Optional: true,
+	}
+
+	switch p.peekToken.Type {
+	case token.LBRACKET:
+		p.nextToken()
+		p.nextToken()
+		indexExpression.Index = p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+	case token.IDENT:
+		p.nextToken()
+		indexExpression.Index = &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+	default:
+		p.addError(Diagnostic{
+			Span:    tokenSpan(p.peekToken),
+			Actual:  p.peekToken.Type,
+			Message: fmt.Sprintf("expected [ or identifier after ?., got %s instead", p.peekToken.Type),
+		})
+		return nil
+	}
+
 	return indexExpression
 }
 
+// parseConditionalExpression parses the alternative with the precedence right below the ternary one,
+// so it is right associative, i.e. `a ? b : c ? d : e` is `a ? b : (c ? d : e)`
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{
+		Token:     p.currToken,
+		Condition: condition,
+	}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Alternative = p.parseExpression(TERNARY - 1)
+
+	return expression
+}
+
 func (p *Parser) currTokenIs(t token.TokenType) bool {
 	return p.currToken.Type == t
 }
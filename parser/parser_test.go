@@ -6,6 +6,7 @@ import (
 
 	"github.com/titivuk/go-interpreter/ast"
 	"github.com/titivuk/go-interpreter/lexer"
+	"github.com/titivuk/go-interpreter/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -122,6 +123,34 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e3;", 1000},
+		{"2.5e-1;", 0.25},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world";`
 
@@ -141,6 +170,33 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestStringLiteralEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"tab\tquote\"newline\n";`, "tab\tquote\"newline\n"},
+		{"`line one\nline two \\n`;", "line one\nline two \\n"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %q. got=%q", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -337,6 +393,86 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c != d",
+			"((a == b) && (c != d))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"!a || -b",
+			"((!a) || (-b))",
+		},
+		{
+			"x = a || b",
+			"(x = (a || b))",
+		},
+		{
+			"a[1:2][-1]",
+			"((a[1:2])[(-1)])",
+		},
+		{
+			"a + b[:c * 2]",
+			"(a + (b[:(c * 2)]))",
+		},
+		{
+			`a + "b" in c == d`,
+			"(((a + b) in c) == d)",
+		},
+		{
+			`"x" * 2 in s && !("y" in s)`,
+			"(((x * 2) in s) && (!(y in s)))",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a || b ? c + 1 : d && e",
+			"((a || b) ? (c + 1) : (d && e))",
+		},
+		{
+			"x = a ? b : c",
+			"(x = (a ? b : c))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"a ?? b ?? c",
+			"((a ?? b) ?? c)",
+		},
+		{
+			"a ?? b || c",
+			"(a ?? (b || c))",
+		},
+		{
+			"a ?? b ? c : d",
+			"((a ?? b) ? c : d)",
+		},
+		{
+			"-a?.b + c?.[d][e]",
+			"((-(a?.[b])) + ((c?.[d])[e]))",
+		},
+		{
+			"f(x)?.y?.[0]",
+			"((f(x)?.[y])?.[0])",
+		},
 	}
 
 	for _, tt := range tests {
@@ -747,7 +883,7 @@ func checkParserErrors(t *testing.T, p *Parser) {
 
 	t.Errorf("parser has %d errors", len(errors))
 	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+		t.Errorf("parser error: %q", msg.String())
 	}
 	t.FailNow()
 }
@@ -798,6 +934,87 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart interface{}
+		expectedEnd   interface{}
+	}{
+		{"arr[1:2]", 1, 2},
+		{"arr[-2:]", "(-2)", nil},
+		{"arr[:n]", nil, "n"},
+		{"arr[:]", nil, nil},
+		{"arr[i + 1:len(arr) - 1]", "(i + 1)", "(len(arr) - 1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, sliceExp.Left, "arr") {
+			return
+		}
+
+		testSliceBound(t, tt.input, sliceExp.Start, tt.expectedStart)
+		testSliceBound(t, tt.input, sliceExp.End, tt.expectedEnd)
+	}
+}
+
+func TestSliceExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:2:3]", "1:6: error: expected next token to be ], got : instead"},
+		{"a[1 2]", "1:5: error: expected next token to be ], got INT instead"},
+		{"a[:", "1:4: error: no prefix parse function for EOF found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors", tt.input)
+		}
+
+		if errors[0].String() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0].String())
+		}
+	}
+}
+
+func testSliceBound(t *testing.T, input string, bound ast.Expression, expected interface{}) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case nil:
+		if bound != nil {
+			t.Errorf("%q: bound is not omitted. got=%s", input, bound.String())
+		}
+	case int:
+		testIntegerLiteral(t, bound, int64(expected))
+	case string:
+		if bound == nil || bound.String() != expected {
+			t.Errorf("%q: wrong bound. expected=%q, got=%v", input, expected, bound)
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -816,21 +1033,28 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	expected := map[string]int64{
-		"one":   1,
-		"two":   2,
-		"three": 3,
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
+	// pairs keep the source order
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
 		}
 
-		expectedValue := expected[literal.String()]
+		if literal.String() != expected[i].key {
+			t.Errorf("pairs[%d] has wrong key. want=%q, got=%q", i, expected[i].key, literal.String())
+		}
 
-		testIntegerLiteral(t, value, expectedValue)
+		testIntegerLiteral(t, pair.Value, expected[i].value)
 	}
 }
 
@@ -883,10 +1107,10 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		},
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
 			continue
 		}
 
@@ -896,6 +1120,768 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 			continue
 		}
 
-		testFunc(value)
+		testFunc(pair.Value)
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let x 5;", "1:7: error: expected next token to be =, got INT instead"},
+		{"let x = 1;\nadd(1, 2;", "2:9: error: expected next token to be ), got ; instead"},
+		{"\n  let = 1;", "2:7: error: expected next token to be IDENT, got = instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", tt.input)
+		}
+
+		if errors[0].String() != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, errors[0].String())
+		}
+	}
+}
+
+func TestParserDiagnostic(t *testing.T) {
+	l := lexer.New("let x = (1 + 2;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 diagnostic. got=%d (%v)", len(errors), errors)
+	}
+
+	d := errors[0]
+	if d.Severity != SeverityError {
+		t.Errorf("wrong severity. got=%s", d.Severity)
+	}
+	if d.Expected != token.RPAREN {
+		t.Errorf("wrong expected token. got=%q", d.Expected)
+	}
+	if d.Actual != token.SEMICOLON {
+		t.Errorf("wrong actual token. got=%q", d.Actual)
+	}
+	if d.Span.Start.Line != 1 || d.Span.Start.Column != 15 || d.Span.End.Column != 16 {
+		t.Errorf("wrong span. got=%+v", d.Span)
+	}
+	if d.Message != "expected next token to be ), got ; instead" {
+		t.Errorf("wrong message. got=%q", d.Message)
+	}
+}
+
+func TestParserRecovery(t *testing.T) {
+	input := `
+let x 5;
+let y = 10;
+let = 1;
+add(1, 2;
+let f = fn(a) {
+  let b = ;
+  a + 1;
+};
+y;
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expectedErrors := []string{
+		"2:7: error: expected next token to be =, got INT instead",
+		"4:5: error: expected next token to be IDENT, got = instead",
+		"5:9: error: expected next token to be ), got ; instead",
+		"7:11: error: no prefix parse function for ; found",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expectedErrors) {
+		t.Fatalf("wrong number of diagnostics. expected=%d, got=%d (%v)",
+			len(expectedErrors), len(errors), errors)
+	}
+
+	for i, expected := range expectedErrors {
+		if errors[i].String() != expected {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, expected, errors[i].String())
+		}
+	}
+
+	// statements without errors are still parsed
+	expectedProgram := "let y = 10;let f = fn(a) {(a + 1)};y"
+	if program.String() != expectedProgram {
+		t.Errorf("wrong program. expected=%q, got=%q", expectedProgram, program.String())
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	l := lexer.New(`throw "boom"; throw x + 1`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	expected := []string{`throw boom;`, `throw (x + 1);`}
+	for i, stmt := range program.Statements {
+		throwStmt, ok := stmt.(*ast.ThrowStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ThrowStatement. got=%T", stmt)
+		}
+
+		if throwStmt.String() != expected[i] {
+			t.Errorf("wrong statement. expected=%q, got=%q", expected[i], throwStmt.String())
+		}
+	}
+}
+
+func TestTryExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedParam   string
+		expectedCatch   bool
+		expectedFinally bool
+	}{
+		{`try { x } catch (e) { y }`, "e", true, false},
+		{`try { x } finally { z }`, "", false, true},
+		{`let v = try { x } catch (err) { y } finally { z };`, "err", true, true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var exp ast.Expression
+		switch stmt := program.Statements[0].(type) {
+		case *ast.ExpressionStatement:
+			exp = stmt.Expression
+		case *ast.LetStatement:
+			exp = stmt.Value
+		}
+
+		try, ok := exp.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.TryExpression. got=%T", exp)
+		}
+
+		if len(try.Block.Statements) != 1 || !testIdentifier(t, try.Block.Statements[0].(*ast.ExpressionStatement).Expression, "x") {
+			t.Errorf("wrong try block: %s", try.Block.String())
+		}
+
+		if (try.Catch != nil) != tt.expectedCatch {
+			t.Errorf("%q: wrong catch. got=%v", tt.input, try.Catch)
+		}
+
+		if tt.expectedCatch && try.CatchParam.Value != tt.expectedParam {
+			t.Errorf("%q: wrong catch parameter. expected=%q, got=%q", tt.input, tt.expectedParam, try.CatchParam.Value)
+		}
+
+		if (try.Finally != nil) != tt.expectedFinally {
+			t.Errorf("%q: wrong finally. got=%v", tt.input, try.Finally)
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { x }`, "1:10: error: expected catch or finally after try block, got EOF instead"},
+		{`try { x } catch { y }`, "1:17: error: expected next token to be (, got { instead"},
+		{`try { x } catch (1) { y }`, "1:18: error: expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors", tt.input)
+		}
+
+		if errors[0].String() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0].String())
+		}
+	}
+}
+
+func TestConstStatement(t *testing.T) {
+	l := lexer.New(`const x = 5; let y = 1;`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []struct {
+		name    string
+		isConst bool
+		str     string
+	}{
+		{"x", true, "const x = 5;"},
+		{"y", false, "let y = 1;"},
+	}
+
+	for i, tt := range expected {
+		stmt, ok := program.Statements[i].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[i])
+		}
+
+		if stmt.Name.Value != tt.name || stmt.IsConst() != tt.isConst {
+			t.Errorf("wrong declaration. expected=%s (const=%t), got=%s (const=%t)",
+				tt.name, tt.isConst, stmt.Name.Value, stmt.IsConst())
+		}
+
+		if stmt.String() != tt.str {
+			t.Errorf("wrong statement. expected=%q, got=%q", tt.str, stmt.String())
+		}
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // empty if the program is fine
+	}{
+		{"let x = 1; let x = 2;", "1:16: error: x is already declared in this scope"},
+		{"let x = 1; const x = 2;", "1:18: error: x is already declared in this scope"},
+		{"fn() { let a = 1; if (a) { let b = 1; }; let a = 2; }", "1:46: error: a is already declared in this scope"},
+		// blocks share the scope of the function or the program around them
+		{"let x = 1; if (x) { let x = 2; }", "1:25: error: x is already declared in this scope"},
+		{"let a = 1; if (true) { let a = 2 }; a", "1:28: error: a is already declared in this scope"},
+		{"let x = 1; while (x) { let x = 2; }", "1:28: error: x is already declared in this scope"},
+		{"if (true) { let x = 1; } else { let x = 2; }", "1:37: error: x is already declared in this scope"},
+		// functions and catch blocks may declare the names of the outer scope
+		{"let x = 1; let f = fn() { let x = 2; };", ""},
+		{"let x = 1; let m = macro() { let x = 2; };", ""},
+		{"let e = 1; try { 1 } catch (e) { let x = e; }; let x = 2;", ""},
+		{"let x = 1; x = 2;", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.Strict = true
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if tt.expected == "" {
+			if len(errors) != 0 {
+				t.Errorf("%q: unexpected parser errors: %v", tt.input, errors)
+			}
+			continue
+		}
+
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors", tt.input)
+		}
+
+		if errors[0].String() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0].String())
+		}
+	}
+
+	// redeclaration is allowed unless the parser is strict
+	l := lexer.New("let x = 1; let x = 2;")
+	p := New(l)
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = y + 1 * 2", "(x = (y + (1 * 2)))"},
+		{"a = b = 1", "(a = (b = 1))"},
+		{"x += 1", "(x += 1)"},
+		{"x -= f(1)", "(x -= f(1))"},
+		{"arr[i + 1] *= 2", "((arr[(i + 1)]) *= 2)"},
+		{`h["k"] /= 2`, "((h[k]) /= 2)"},
+		{"f(x = 1)", "f((x = 1))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("%q: wrong expression. expected=%q, got=%q", tt.input, tt.expected, stmt.Expression.String())
+		}
+	}
+}
+
+func TestAssignExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2", "1:3: error: cannot assign to 1"},
+		{"x + y = 2", "1:7: error: cannot assign to (x + y)"},
+		{"f() += 2", "1:5: error: cannot assign to f()"},
+		{"h?.k = 2", "1:6: error: cannot assign to (h?.[k])"},
+		{"a[1:] = [2]", "1:7: error: cannot assign to (a[1:])"},
+		{"c ? a : b = 2", "1:11: error: cannot assign to (c ? a : b)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors", tt.input)
+		}
+
+		if errors[0].String() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0].String())
+		}
+	}
+}
+
+func TestConditionalExpressionParsing(t *testing.T) {
+	l := lexer.New(`x < 1 ? "low" : "high"`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.ConditionalExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.ConditionalExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", 1) {
+		return
+	}
+
+	if exp.Consequence.String() != "low" || exp.Alternative.String() != "high" {
+		t.Errorf("wrong branches. got=%q and %q", exp.Consequence.String(), exp.Alternative.String())
+	}
+}
+
+func TestOptionalIndexExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedIndex string
+	}{
+		{`h?.["k" + "ey"]`, "(k + ey)"},
+		{`h?.key`, "key"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.IndexExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not *ast.IndexExpression. got=%T", stmt.Expression)
+		}
+
+		if !exp.Optional {
+			t.Errorf("%q: exp.Optional is not true", tt.input)
+		}
+
+		if !testIdentifier(t, exp.Left, "h") {
+			return
+		}
+
+		if exp.Index.String() != tt.expectedIndex {
+			t.Errorf("%q: wrong index. expected=%q, got=%q", tt.input, tt.expectedIndex, exp.Index.String())
+		}
+	}
+
+	// a?.field is a string key, not a variable
+	l := lexer.New(`h?.key`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	index := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression).Index
+	if str, ok := index.(*ast.StringLiteral); !ok || str.Value != "key" {
+		t.Errorf("index is not *ast.StringLiteral with value key. got=%T (%+v)", index, index)
+	}
+}
+
+func TestConditionalExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a ? b", "1:6: error: expected next token to be :, got EOF instead"},
+		{"a ? b c", "1:7: error: expected next token to be :, got IDENT instead"},
+		{"h?.1", "1:4: error: expected [ or identifier after ?., got INT instead"},
+		{"h?.(1)", "1:4: error: expected [ or identifier after ?., got ( instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors", tt.input)
+		}
+
+		if errors[0].String() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0].String())
+		}
+	}
+}
+
+func TestTemplateLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input               string
+		expectedStrings     []string
+		expectedExpressions []string
+	}{
+		{`"hello ${name}!"`, []string{"hello ", "!"}, []string{"name"}},
+		{`"${a}${b + 1}"`, []string{"", "", ""}, []string{"a", "(b + 1)"}},
+		{`"sum: ${add(1, {"k": 2}["k"])}"`, []string{"sum: ", ""}, []string{"add(1, ({k:2}[k]))"}},
+		{`"outer ${"inner ${x}"}"`, []string{"outer ", ""}, []string{"inner ${x}"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		template, ok := stmt.Expression.(*ast.TemplateLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.TemplateLiteral. got=%T", stmt.Expression)
+		}
+
+		if len(template.Strings) != len(tt.expectedStrings) {
+			t.Fatalf("%q: wrong number of strings. expected=%d, got=%d", tt.input, len(tt.expectedStrings), len(template.Strings))
+		}
+
+		for i, str := range tt.expectedStrings {
+			if template.Strings[i] != str {
+				t.Errorf("%q: strings[%d] wrong. expected=%q, got=%q", tt.input, i, str, template.Strings[i])
+			}
+		}
+
+		if len(template.Expressions) != len(tt.expectedExpressions) {
+			t.Fatalf("%q: wrong number of expressions. expected=%d, got=%d", tt.input, len(tt.expectedExpressions), len(template.Expressions))
+		}
+
+		for i, exp := range tt.expectedExpressions {
+			if template.Expressions[i].String() != exp {
+				t.Errorf("%q: expressions[%d] wrong. expected=%q, got=%q", tt.input, i, exp, template.Expressions[i].String())
+			}
+		}
+	}
+}
+
+func TestTemplateLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${}"`, "1:6: error: empty interpolation"},
+		{`"a ${x y}"`, "1:8: error: expected } after interpolated expression, got IDENT instead"},
+		{`"a ${x`, "1:7: error: expected } after interpolated expression, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors", tt.input)
+		}
+
+		if errors[0].String() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0].String())
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	l := lexer.New(`while (x < 10) { x; break; continue; }`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body does not contain 3 statements. got=%d", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("stmt not *ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("stmt not *ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input             string
+		expectedVariables []string
+		expected          string
+	}{
+		{`for (x in [1, 2]) { x }`, []string{"x"}, "for (x in [1, 2]) x"},
+		{`for (k, v in h) { k; v; }`, []string{"k", "v"}, "for (k, v in h) kv"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ForStatement. got=%T", program.Statements[0])
+		}
+
+		if len(stmt.Variables) != len(tt.expectedVariables) {
+			t.Fatalf("wrong number of variables. expected=%d, got=%d", len(tt.expectedVariables), len(stmt.Variables))
+		}
+
+		for i, v := range tt.expectedVariables {
+			testLiteralExpression(t, stmt.Variables[i], v)
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong statement. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestLoopsAsStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`while (x) { x }; x`, "whilex xx"},
+		{`for (x in xs) { x }; x`, "for (x in xs) xx"},
+		// blocks of an if that is a statement itself may stop the loop, at any depth
+		{`while (x) { if (x) { try { break; } finally { 1 } } }`, "whilex ifx try break; finally 1"},
+		{`while (x) { [fn() { while (x) { continue; } }] }`, "whilex [fn() {whilex continue;}]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong program. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`break;`, "1:1: error: break outside of loop"},
+		{`if (true) { continue }`, "1:13: error: continue outside of loop"},
+		// functions do not see loops they are defined in
+		{`while (true) { fn() { break; } }`, "1:23: error: break outside of loop"},
+		{`for (x of xs) { x }`, "1:8: error: expected next token to be IN, got IDENT instead"},
+		{`for (1 in xs) { x }`, "1:6: error: expected next token to be IDENT, got INT instead"},
+		// the value of the if is used, break would leave the array unfinished
+		{`while (true) { [1, if (true) { continue; }] }`, "1:32: error: continue can not be used inside of an expression"},
+		{`while (true) { let x = if (true) { break; } }`, "1:36: error: break can not be used inside of an expression"},
+		{`while (true) { puts(try { break; }) }`, "1:27: error: break can not be used inside of an expression"},
+		{`while (true) { [if (true) { if (true) { break; } }] }`, "1:41: error: break can not be used inside of an expression"},
+		{`while (true) { if (true) { break; } + 1 }`, "1:28: error: break can not be used inside of an expression"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors", tt.input)
+		}
+
+		if errors[0].String() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0].String())
+		}
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestDiagnosticSpans(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart int
+		expectedEnd   int
+	}{
+		// the span covers the quotes and the escape, not only the decoded literal
+		{`let "a\tb" = 1`, 5, 11},
+		{"let `ab` = 1", 5, 9},
+		{`let "a ${x}" = 1`, 5, 10},
+		{`let 123 = 1`, 5, 8},
+		{`let x = "a\qb"`, 11, 13},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", tt.input)
+		}
+
+		span := errors[0].Span
+		if span.Start.Column != tt.expectedStart || span.End.Column != tt.expectedEnd {
+			t.Errorf("%q: wrong span. expected=1:%d-1:%d, got=%s-%s",
+				tt.input, tt.expectedStart, tt.expectedEnd, span.Start, span.End)
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements int
+	}{
+		{"let x = 1; /* never closed", []string{"1:12: error: unterminated block comment"}, 1},
+		{"let x = 1 @ 2;", []string{"1:11: error: illegal character \"@\""}, 1},
+		{"// just a comment", []string{}, 0},
+		{"let x = 1; // comment\nx", []string{}, 2},
+		{`let x = "abc`, []string{"1:9: error: unterminated string"}, 1},
+		{`let x = "a\qb"; let y = 2;`, []string{"1:11: error: invalid escape sequence \\q"}, 2},
+		{`"\q" + 1`, []string{"1:2: error: invalid escape sequence \\q"}, 1},
+		{"`abc", []string{"1:1: error: unterminated string"}, 1},
+		{`"a ${x} \q b"`, []string{"1:9: error: invalid escape sequence \\q"}, 1},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Fatalf("%q: wrong number of errors. expected=%d, got=%d (%v)",
+				tt.input, len(tt.expectedErrors), len(errors), errors)
+		}
+
+		for i, expected := range tt.expectedErrors {
+			if errors[i].String() != expected {
+				t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, expected, errors[i].String())
+			}
+		}
+
+		if len(program.Statements) != tt.expectedStatements {
+			t.Errorf("%q: wrong number of statements. expected=%d, got=%d",
+				tt.input, tt.expectedStatements, len(program.Statements))
+		}
 	}
 }
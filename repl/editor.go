@@ -0,0 +1,331 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrInterrupted is returned by the editor when the user presses Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// key codes the editor understands
+const (
+	KEY_CTRL_A    = 1
+	KEY_CTRL_B    = 2
+	KEY_CTRL_C    = 3
+	KEY_CTRL_D    = 4
+	KEY_CTRL_E    = 5
+	KEY_CTRL_F    = 6
+	KEY_CTRL_G    = 7
+	KEY_CTRL_H    = 8
+	KEY_CTRL_K    = 11
+	KEY_CTRL_L    = 12
+	KEY_ENTER     = 13
+	KEY_CTRL_N    = 14
+	KEY_CTRL_P    = 16
+	KEY_CTRL_R    = 18
+	KEY_CTRL_U    = 21
+	KEY_CTRL_W    = 23
+	KEY_ESC       = 27
+	KEY_BACKSPACE = 127
+)
+
+// Editor is a minimal line editor, it expects the terminal to be in raw mode,
+// so every key press reaches it immediately and nothing is echoed by the terminal.
+//
+// Supported keys: arrows, Home/End, Delete, Backspace,
+// Ctrl-A/E/B/F to move, Ctrl-K/U/W to cut, Ctrl-P/N to walk the history,
+// Ctrl-R to search the history, Ctrl-L to clear the screen,
+// Ctrl-C to drop the line and Ctrl-D to quit on the empty line
+type Editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *History
+
+	prompt string
+	buf    []rune
+	pos    int // cursor position in buf
+}
+
+func NewEditor(in io.Reader, out io.Writer, history *History) *Editor {
+	return &Editor{in: bufio.NewReader(in), out: out, history: history}
+}
+
+// ReadLine shows the prompt and returns the line once the user presses Enter
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	e.prompt = prompt
+	e.buf = []rune{}
+	e.pos = 0
+
+	// historyIndex points at the history entry shown in the editor,
+	// history.Len() stands for the line being typed, which is kept in draft
+	historyIndex := e.history.Len()
+	draft := []rune{}
+
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case KEY_ENTER, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(e.buf), nil
+		case KEY_CTRL_C:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case KEY_CTRL_D:
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case KEY_BACKSPACE, KEY_CTRL_H:
+			e.deleteBackward()
+		case KEY_CTRL_A:
+			e.pos = 0
+		case KEY_CTRL_E:
+			e.pos = len(e.buf)
+		case KEY_CTRL_B:
+			e.moveLeft()
+		case KEY_CTRL_F:
+			e.moveRight()
+		case KEY_CTRL_K:
+			e.buf = e.buf[:e.pos]
+		case KEY_CTRL_U:
+			e.buf = e.buf[e.pos:]
+			e.pos = 0
+		case KEY_CTRL_W:
+			e.deleteWord()
+		case KEY_CTRL_L:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case KEY_CTRL_P:
+			historyIndex, draft = e.showHistory(historyIndex, historyIndex-1, draft)
+		case KEY_CTRL_N:
+			historyIndex, draft = e.showHistory(historyIndex, historyIndex+1, draft)
+		case KEY_CTRL_R:
+			line, accepted, err := e.reverseSearch()
+			if err != nil {
+				return "", err
+			}
+			if accepted {
+				fmt.Fprint(e.out, "\r\n")
+				return line, nil
+			}
+		case KEY_ESC:
+			key, err := e.readEscapeSequence()
+			if err != nil {
+				return "", err
+			}
+
+			switch key {
+			case "A": // up
+				historyIndex, draft = e.showHistory(historyIndex, historyIndex-1, draft)
+			case "B": // down
+				historyIndex, draft = e.showHistory(historyIndex, historyIndex+1, draft)
+			case "C": // right
+				e.moveRight()
+			case "D": // left
+				e.moveLeft()
+			case "H", "1~", "7~": // home
+				e.pos = 0
+			case "F", "4~", "8~": // end
+				e.pos = len(e.buf)
+			case "3~": // delete
+				e.deleteForward()
+			}
+		default:
+			// ignore the rest of control characters
+			if r < ' ' {
+				continue
+			}
+			e.insert(r)
+		}
+
+		e.refresh()
+	}
+}
+
+func (e *Editor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+}
+
+func (e *Editor) deleteBackward() {
+	if e.pos == 0 {
+		return
+	}
+
+	e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+	e.pos--
+}
+
+func (e *Editor) deleteForward() {
+	if e.pos >= len(e.buf) {
+		return
+	}
+
+	e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+}
+
+// deleteWord removes the word before the cursor together with the spaces after it
+func (e *Editor) deleteWord() {
+	start := e.pos
+	for start > 0 && e.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && e.buf[start-1] != ' ' {
+		start--
+	}
+
+	e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+	e.pos = start
+}
+
+func (e *Editor) moveLeft() {
+	if e.pos > 0 {
+		e.pos--
+	}
+}
+
+func (e *Editor) moveRight() {
+	if e.pos < len(e.buf) {
+		e.pos++
+	}
+}
+
+// showHistory replaces the line with the history entry at index "to".
+// It returns the new index and the draft of the line the user was typing before walking the history
+func (e *Editor) showHistory(from int, to int, draft []rune) (int, []rune) {
+	if to < 0 || to > e.history.Len() {
+		return from, draft
+	}
+
+	if from == e.history.Len() {
+		draft = e.buf
+	}
+
+	if to == e.history.Len() {
+		e.buf = draft
+	} else {
+		e.buf = []rune(e.history.Entry(to))
+	}
+	e.pos = len(e.buf)
+
+	return to, draft
+}
+
+// reverseSearch implements Ctrl-R incremental search.
+// Enter accepts the match and submits it, Ctrl-G or Ctrl-C cancels the search,
+// any other control key puts the match into the editor and acts as usual
+func (e *Editor) reverseSearch() (string, bool, error) {
+	query := []rune{}
+	match := -1
+	from := e.history.Len() - 1
+
+	original := e.buf
+	originalPos := e.pos
+
+	for {
+		found := ""
+		if match >= 0 {
+			found = e.history.Entry(match)
+		}
+		fmt.Fprintf(e.out, "\r(reverse-i-search)`%s': %s\x1b[K", string(query), displayable(found))
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", false, err
+		}
+
+		switch {
+		case r == KEY_ENTER || r == '\n':
+			if match < 0 {
+				return string(original), true, nil
+			}
+			return found, true, nil
+		case r == KEY_CTRL_G || r == KEY_CTRL_C:
+			e.buf = original
+			e.pos = originalPos
+			return "", false, nil
+		case r == KEY_CTRL_R:
+			// look for an older match
+			if match > 0 {
+				if older := e.history.SearchBackward(string(query), match-1); older >= 0 {
+					match = older
+				}
+			}
+		case r == KEY_BACKSPACE || r == KEY_CTRL_H:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match = e.history.SearchBackward(string(query), from)
+			}
+		case r < ' ':
+			if match >= 0 {
+				e.buf = []rune(found)
+				e.pos = len(e.buf)
+			}
+			// let ReadLine handle the key
+			e.in.UnreadRune()
+			return "", false, nil
+		default:
+			query = append(query, r)
+			start := from
+			if match >= 0 {
+				start = match
+			}
+			match = e.history.SearchBackward(string(query), start)
+		}
+	}
+}
+
+// readEscapeSequence reads the rest of ESC [ ... or ESC O ... sequence
+// and returns it without the prefix, e.g. "A" for the up arrow or "3~" for delete
+func (e *Editor) readEscapeSequence() (string, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+
+	if r != '[' && r != 'O' {
+		return "", nil
+	}
+
+	var seq strings.Builder
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		seq.WriteRune(r)
+
+		// digits and ; are parameters, anything else terminates the sequence
+		if (r < '0' || r > '9') && r != ';' {
+			return seq.String(), nil
+		}
+	}
+}
+
+// refresh redraws the line and puts the cursor where it belongs
+func (e *Editor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K\r", e.prompt, displayable(string(e.buf)))
+
+	column := len([]rune(e.prompt)) + e.pos
+	if column > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dC", column)
+	}
+}
+
+// displayable shows multi-line history entries on a single line
+func displayable(s string) string {
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -0,0 +1,71 @@
+package repl
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEditorReadLine(t *testing.T) {
+	history := NewHistory()
+	history.Add("let foo = 1;")
+	history.Add("let bar = 2;")
+
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"plain", "1 + 2\r", "1 + 2"},
+		{"backspace", "1 + 3\x7f2\r", "1 + 2"},
+		{"arrows", "ac\x1b[Db\r", "abc"},
+		{"home and end", "bc\x01a\x05d\r", "abcd"},
+		{"home and end escape", "bc\x1b[Ha\x1b[Fd\r", "abcd"},
+		{"delete", "abxc\x1b[D\x1b[D\x1b[3~\r", "abc"},
+		{"ctrl-k", "abcdef\x01\x06\x06\x06\x0b\r", "abc"},
+		{"ctrl-u", "abc def\x1b[D\x1b[D\x1b[D\x15\r", "def"},
+		{"ctrl-w", "let foo bar\x17baz\r", "let foo baz"},
+		{"utf-8", "héllo\x1b[D\x1b[D\x1b[D\x7fe\r", "hello"},
+		{"history up", "\x1b[A\r", "let bar = 2;"},
+		{"history up twice", "\x1b[A\x1b[A\r", "let foo = 1;"},
+		{"history up and down", "draft\x1b[A\x1b[B\r", "draft"},
+		{"history stops at the oldest", "\x10\x10\x10\r", "let foo = 1;"},
+		{"edit history entry", "\x1b[A\x7f\x7f\r", "let bar = "},
+		{"reverse search", "\x12foo\r", "let foo = 1;"},
+		{"reverse search older", "\x12let\x12\r", "let foo = 1;"},
+		{"reverse search edit", "\x12bar\x1b[D+\r", "let bar = 2+;"},
+		{"reverse search cancel", "x\x12bar\x07y\r", "xy"},
+	}
+
+	for _, tt := range tests {
+		e := NewEditor(strings.NewReader(tt.keys), io.Discard, history)
+
+		line, err := e.ReadLine(PROMT)
+		if err != nil {
+			t.Errorf("%s: ReadLine returned error: %s", tt.name, err)
+			continue
+		}
+
+		if line != tt.expected {
+			t.Errorf("%s: wrong line. want=%q, got=%q", tt.name, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorControlKeys(t *testing.T) {
+	e := NewEditor(strings.NewReader("abc\x03"), io.Discard, NewHistory())
+	if _, err := e.ReadLine(PROMT); err != ErrInterrupted {
+		t.Errorf("Ctrl-C must interrupt the line. got=%v", err)
+	}
+
+	e = NewEditor(strings.NewReader("\x04"), io.Discard, NewHistory())
+	if _, err := e.ReadLine(PROMT); err != io.EOF {
+		t.Errorf("Ctrl-D on the empty line must return io.EOF. got=%v", err)
+	}
+
+	e = NewEditor(strings.NewReader("ab\x01\x04\r"), io.Discard, NewHistory())
+	line, err := e.ReadLine(PROMT)
+	if err != nil || line != "b" {
+		t.Errorf("Ctrl-D must delete the char under the cursor. got=%q, %v", line, err)
+	}
+}
@@ -0,0 +1,129 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const MAX_HISTORY_ENTRIES = 1000
+
+// History keeps previously entered inputs, the oldest entry first.
+// If the history has a file, every added entry is appended to it,
+// so the history survives REPL restarts
+type History struct {
+	entries []string
+	file    string
+}
+
+func NewHistory() *History {
+	return &History{entries: []string{}}
+}
+
+// LoadHistory reads the history from the file and keeps appending new entries to it.
+// Missing file is not an error, it is created once the first entry is added
+func LoadHistory(file string) (*History, error) {
+	h := NewHistory()
+	h.file = file
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// entries are stored quoted, so multi-line inputs take a single line in the file
+		entry, err := strconv.Unquote(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		h.entries = append(h.entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return h, err
+	}
+
+	// the file only grows while the REPL runs, so we shrink it on start
+	if len(h.entries) > MAX_HISTORY_ENTRIES {
+		h.truncate()
+		return h, h.save()
+	}
+
+	return h, nil
+}
+
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// Entry returns the entry at the index, 0 is the oldest one
+func (h *History) Entry(index int) string {
+	return h.entries[index]
+}
+
+// Add appends the entry unless it is blank or repeats the latest entry
+func (h *History) Add(entry string) error {
+	if strings.TrimSpace(entry) == "" {
+		return nil
+	}
+
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return nil
+	}
+
+	h.entries = append(h.entries, entry)
+	h.truncate()
+
+	if h.file == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(strconv.Quote(entry) + "\n")
+	return err
+}
+
+// SearchBackward looks for the newest entry containing query, starting from the index "from" and going back.
+// It returns -1 if there is no such entry
+func (h *History) SearchBackward(query string, from int) int {
+	if from >= len(h.entries) {
+		from = len(h.entries) - 1
+	}
+
+	for i := from; i >= 0; i-- {
+		if strings.Contains(h.entries[i], query) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// save overwrites the file with the current entries
+func (h *History) save() error {
+	var out strings.Builder
+	for _, entry := range h.entries {
+		out.WriteString(strconv.Quote(entry) + "\n")
+	}
+
+	return os.WriteFile(h.file, []byte(out.String()), 0o600)
+}
+
+func (h *History) truncate() {
+	if len(h.entries) > MAX_HISTORY_ENTRIES {
+		h.entries = h.entries[len(h.entries)-MAX_HISTORY_ENTRIES:]
+	}
+}
@@ -0,0 +1,99 @@
+package repl
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryAdd(t *testing.T) {
+	h := NewHistory()
+
+	h.Add("1 + 1")
+	h.Add("1 + 1")
+	h.Add("   ")
+	h.Add("let f = fn(x) {\n  x\n};")
+
+	expected := []string{"1 + 1", "let f = fn(x) {\n  x\n};"}
+	if h.Len() != len(expected) {
+		t.Fatalf("wrong number of entries. want=%d, got=%d", len(expected), h.Len())
+	}
+
+	for i, entry := range expected {
+		if h.Entry(i) != entry {
+			t.Errorf("entry %d wrong. want=%q, got=%q", i, entry, h.Entry(i))
+		}
+	}
+}
+
+func TestHistorySearchBackward(t *testing.T) {
+	h := NewHistory()
+	h.Add("let foo = 1;")
+	h.Add("let bar = 2;")
+	h.Add("foo + bar")
+
+	tests := []struct {
+		query    string
+		from     int
+		expected int
+	}{
+		{"foo", 2, 2},
+		{"foo", 1, 0},
+		{"bar", 100, 2},
+		{"let", 2, 1},
+		{"baz", 2, -1},
+	}
+
+	for _, tt := range tests {
+		if got := h.SearchBackward(tt.query, tt.from); got != tt.expected {
+			t.Errorf("SearchBackward(%q, %d) wrong. want=%d, got=%d", tt.query, tt.from, tt.expected, got)
+		}
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+
+	h, err := LoadHistory(file)
+	if err != nil {
+		t.Fatalf("LoadHistory returned error: %s", err)
+	}
+
+	h.Add("1 + 1")
+	h.Add("let f = fn() {\n  \"quoted\"\n};")
+
+	loaded, err := LoadHistory(file)
+	if err != nil {
+		t.Fatalf("LoadHistory returned error: %s", err)
+	}
+
+	if loaded.Len() != 2 {
+		t.Fatalf("wrong number of entries. want=2, got=%d", loaded.Len())
+	}
+
+	if loaded.Entry(1) != "let f = fn() {\n  \"quoted\"\n};" {
+		t.Errorf("multi-line entry wrong. got=%q", loaded.Entry(1))
+	}
+}
+
+func TestHistoryFileIsTruncated(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+
+	h, _ := LoadHistory(file)
+	for i := 0; i < MAX_HISTORY_ENTRIES+10; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+	}
+
+	loaded, err := LoadHistory(file)
+	if err != nil {
+		t.Fatalf("LoadHistory returned error: %s", err)
+	}
+
+	if loaded.Len() != MAX_HISTORY_ENTRIES {
+		t.Fatalf("wrong number of entries. want=%d, got=%d", MAX_HISTORY_ENTRIES, loaded.Len())
+	}
+
+	if loaded.Entry(0) != "10" {
+		t.Errorf("oldest entries have to be dropped. got=%q", loaded.Entry(0))
+	}
+}
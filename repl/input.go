@@ -0,0 +1,48 @@
+package repl
+
+import (
+	"github.com/titivuk/go-interpreter/lexer"
+	"github.com/titivuk/go-interpreter/parser"
+	"github.com/titivuk/go-interpreter/token"
+)
+
+// isIncomplete reports whether the input ends in the middle of an expression,
+// i.e. there is an unclosed bracket, raw string or block comment, or the parser ran out of tokens.
+// The REPL keeps reading lines until the input is complete
+func isIncomplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		case token.ERROR:
+			if tok.Literal == lexer.ERR_UNTERMINATED_COMMENT {
+				return true
+			}
+			// only raw strings may span lines, "..." string ends at the end of the line, so it is an error
+			if tok.Literal == lexer.ERR_UNTERMINATED_STRING {
+				return input[tok.Pos.Offset] == '`'
+			}
+		}
+	}
+
+	// too many closing brackets can not be fixed by reading more
+	if depth != 0 {
+		return depth > 0
+	}
+
+	p := parser.New(lexer.New(input))
+	p.ParseProgram()
+
+	for _, d := range p.Errors() {
+		if d.Actual == token.EOF {
+			return true
+		}
+	}
+
+	return false
+}
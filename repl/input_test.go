@@ -0,0 +1,43 @@
+package repl
+
+import "testing"
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"let x = 5;", false},
+		{"", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n  x + 1\n}", false},
+		{"add(1,", true},
+		{"[1, 2", true},
+		{"{\"a\": 1", true},
+		{"1 + ", true},
+		{"let x =", true},
+		{`"abc`, false}, // "..." string can not span lines, so it is an error
+		{`"abc"`, false},
+		{`"a" + "b"`, false},
+		{"`abc", true},
+		{"`abc\ndef", true},
+		{"`abc\ndef`", false},
+		{"`abc` + `", true},
+		{"1)", false},
+		{"1 /* comment", true},
+		{"1 /* comment */", false},
+		{"1 // comment", false},
+		{"fn() { // {", true},
+		{"if (x > 1) { 1 } else {", true},
+		{`"a ${x`, true},
+		{"\"a ${f(\n1)}\"", false},
+		{`"a ${x}`, false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.expected {
+			t.Errorf("isIncomplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -2,16 +2,28 @@ package repl
 
 import (
 	"bufio"
-	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/titivuk/go-interpreter/ast"
+	"github.com/titivuk/go-interpreter/compiler"
 	"github.com/titivuk/go-interpreter/evaluator"
 	"github.com/titivuk/go-interpreter/lexer"
 	"github.com/titivuk/go-interpreter/object"
 	"github.com/titivuk/go-interpreter/parser"
+	"github.com/titivuk/go-interpreter/vm"
+)
+
+// backends that can execute the program
+const (
+	ENGINE_EVAL = "eval" // tree-walking evaluator
+	ENGINE_VM   = "vm"   // bytecode compiler and vm
 )
 
 const PROMT = ">> "
+const CONTINUATION_PROMPT = ".. " // shown while the input is incomplete, e.g. a function body is not closed yet
 const MONKEY_FACE = `            __,__
    .--.  .-"     "-.  .--.
   / .. \/  .-. .-.  \/ .. \
@@ -25,26 +37,36 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
-func Start(in io.Reader, out io.Writer) {
-	// Scanner provides a convenient interface for reading data such as a file of newline-delimited lines of text.
-	// Successive calls to the Scan method will step through the 'tokens' of a file, skipping the bytes between the tokens.
-	// The specification of a token is defined by a split function of type SplitFunc; the default split function breaks the input into lines with line termination stripped.
-	// Split functions are defined in this package for scanning a file into lines, bytes, UTF-8-encoded runes, and space-delimited words.
-	// The client may instead provide a custom split function.
-	scanner := bufio.NewScanner(in)
+// Start runs the REPL, strict makes the parser report names declared twice in a scope
+func Start(in io.Reader, out io.Writer, engine string, strict bool) {
+	reader, history := newLineReader(in, out)
+
 	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+
+	// the vm keeps its state between the lines the same way env does for the evaluator
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
 
 	for {
-		fmt.Fprintf(out, PROMT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := readInput(reader)
+		if err != nil {
 			return
 		}
 
-		// Text returns the most recent token generated by a call to Scan as a newly allocated string holding its bytes.
-		line := scanner.Text()
-		l := lexer.New(line)
+		if history != nil {
+			if err := history.Add(input); err != nil {
+				io.WriteString(out, "failed to save history: "+err.Error()+"\n")
+			}
+		}
+
+		l := lexer.New(input)
 		p := parser.New(l)
+		p.Strict = strict
 
 		program := p.ParseProgram()
 		if len(p.Errors()) > 0 {
@@ -52,7 +74,45 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			io.WriteString(out, "ERROR: "+err.Error()+"\n")
+			continue
+		}
+		program = expanded.(*ast.Program)
+
+		if engine == ENGINE_VM {
+			comp := compiler.NewWithState(symbolTable, constants)
+			err := comp.Compile(program)
+			if err != nil {
+				io.WriteString(out, "ERROR: "+err.Error()+"\n")
+				continue
+			}
+
+			code := comp.Bytecode()
+			constants = code.Constants
+
+			machine := vm.NewWithGlobalsStore(code, globals)
+			err = machine.Run()
+			if err != nil {
+				io.WriteString(out, "ERROR: "+traceback(err)+"\n")
+				continue
+			}
+
+			// let statements and loops produce no value in the evaluator, so we do not print anything either
+			if !ProducesNoValue(program) {
+				io.WriteString(out, machine.LastPoppedStackElem().Inspect())
+				io.WriteString(out, "\n")
+			}
+			continue
+		}
+
 		evaluated := evaluator.Eval(program, env)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			io.WriteString(out, errObj.Traceback()+"\n")
+			continue
+		}
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -61,11 +121,138 @@ func Start(in io.Reader, out io.Writer) {
 
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+// lineReader reads a single line of the input
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader reads lines from non-interactive input, e.g. a pipe
+type plainReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	return r.scanner.Text(), nil
+}
+
+// terminalReader edits lines with Editor, the terminal is in raw mode only while the line is being edited,
+// so the output of the program is printed the usual way
+type terminalReader struct {
+	fd     int
+	editor *Editor
+}
+
+func (r *terminalReader) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	return r.editor.ReadLine(prompt)
+}
+
+// newLineReader picks the line editor with history if the input is a terminal,
+// otherwise it reads plain lines and there is no history
+func newLineReader(in io.Reader, out io.Writer) (lineReader, *History) {
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		history, err := LoadHistory(historyFile())
+		if err != nil {
+			io.WriteString(out, "failed to load history: "+err.Error()+"\n")
+		}
+
+		return &terminalReader{fd: int(f.Fd()), editor: NewEditor(in, out, history)}, history
+	}
+
+	return &plainReader{scanner: bufio.NewScanner(in), out: out}, nil
+}
+
+// historyFile is $MONKEY_HISTORY or ~/.monkey_history
+func historyFile() string {
+	if file := os.Getenv("MONKEY_HISTORY"); file != "" {
+		return file
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".monkey_history")
+}
+
+// readInput reads lines until they form a complete input, e.g. all brackets are closed.
+// Ctrl-C drops everything typed so far
+func readInput(reader lineReader) (string, error) {
+	lines := []string{}
+	prompt := PROMT
+
+	for {
+		line, err := reader.ReadLine(prompt)
+		if err == ErrInterrupted {
+			lines = lines[:0]
+			prompt = PROMT
+			continue
+		}
+		if err != nil {
+			// the input ended in the middle of an expression,
+			// we still run it, so the user sees what is wrong with it
+			if err == io.EOF && len(lines) > 0 {
+				return strings.Join(lines, "\n"), nil
+			}
+			return "", err
+		}
+
+		lines = append(lines, line)
+
+		input := strings.Join(lines, "\n")
+		if !isIncomplete(input) {
+			return input, nil
+		}
+
+		prompt = CONTINUATION_PROMPT
+	}
+}
+
+// traceback adds the call stack to runtime errors of the vm
+func traceback(err error) string {
+	if runtimeErr, ok := err.(*vm.RuntimeError); ok {
+		return runtimeErr.Traceback()
+	}
+
+	return err.Error()
+}
+
+// ProducesNoValue reports whether the program ends without a value, e.g. with a let statement or a loop.
+// The vm leaves the value of the let binding on the stack, but the evaluator returns nothing
+func ProducesNoValue(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return true
+	}
+
+	switch program.Statements[len(program.Statements)-1].(type) {
+	case *ast.LetStatement, *ast.WhileStatement, *ast.ForStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+func printParserErrors(out io.Writer, errors []parser.Diagnostic) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
 	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+	for _, d := range errors {
+		io.WriteString(out, "\t"+d.String()+"\n")
 	}
 }
@@ -0,0 +1,50 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStartMultiLineInput(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(
+  1,
+  2
+)
+`
+
+	for _, engine := range []string{ENGINE_EVAL, ENGINE_VM} {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, engine, false)
+
+		expected := PROMT + CONTINUATION_PROMPT + CONTINUATION_PROMPT +
+			PROMT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + "3\n" +
+			PROMT
+
+		if out.String() != expected {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot =%q", engine, expected, out.String())
+		}
+	}
+}
+
+func TestStartPrintsTraceback(t *testing.T) {
+	input := "let f = fn(x) { x / 0 };\nf(1)\n"
+
+	for _, engine := range []string{ENGINE_EVAL, ENGINE_VM} {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, engine, false)
+
+		expected := PROMT + PROMT +
+			"ERROR: 1:19: division by zero\n" +
+			"Traceback (most recent call first):\n" +
+			"  f called at 1:2\n" +
+			PROMT
+
+		if out.String() != expected {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot =%q", engine, expected, out.String())
+		}
+	}
+}
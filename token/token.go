@@ -1,14 +1,22 @@
 package token
 
+import "fmt"
+
 const (
 	ILLEGAL = "ILLEGAL" // ILLEGAL signifies a token/character we don’t know about
 	EOF     = "EOF"     // EOF stands for "end of file", which tells our parser later on that it can stop
+	ERROR   = "ERROR"   // ERROR is produced by the lexer when the input is malformed, Literal holds the error message
 
 	// identifiers + literals
 	IDENT = "IDENT" // 	add, x, foo, ...
 	INT   = "INT"   // 12345
+	FLOAT = "FLOAT" // 1.5, 2e10, 1.5e-3
 
 	STRING = "STRING"
+	// "a ${x} b ${y} c" is TEMPLATE_START(a ), IDENT(x), TEMPLATE_MIDDLE( b ), IDENT(y) and TEMPLATE_END( c)
+	TEMPLATE_START  = "TEMPLATE_START"
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE"
+	TEMPLATE_END    = "TEMPLATE_END"
 
 	// operators
 	ASSIGN   = "="
@@ -17,8 +25,13 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 	LT       = "<"
 	GT       = ">"
+	LT_EQ    = "<="
+	GT_EQ    = ">="
+	AND      = "&&"
+	OR       = "||"
 
 	// Delimeters
 	COMMA     = ","
@@ -34,30 +47,93 @@ const (
 	// Keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MACRO    = "MACRO"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	// IN_OPERATOR is the operator of `x in y`, the literal of the IN keyword
+	IN_OPERATOR = "in"
+
+	// compound assignment, `x += 1` is `x = x + 1`
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
 	COLON = ":"
+
+	// conditional operators, `c ? a : b`, `a ?? b` and `a?.[k]` or `a?.field`
+	QUESTION       = "?"
+	NULLISH        = "??"
+	OPTIONAL_CHAIN = "?."
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"macro":    MACRO,
+	"throw":    THROW,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 type TokenType string
 
+// Position points at the place in the source where the token starts.
+// Line and Column start at 1, zero value means the position is unknown
+type Position struct {
+	Filename string // empty if the source does not come from a file, e.g. the REPL
+	Offset   int    // byte offset from the beginning of the source
+	Line     int
+	Column   int // rune offset within the line
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns position in the "file:line:column" form, file is omitted if unknown
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+
+	return s
+}
+
 /*
 *
 Token representation of  "let x = 5 + 5;"
@@ -76,6 +152,16 @@ Token representation of  "let x = 5 + 5;"
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+	End     Position // End is right after the last char of the token in the source
+
+	Comments []Comment // comments that precede the token, so a formatter can keep them
+}
+
+// Comment is either a `// line comment` or a `/* block comment */`, Text includes the delimiters
+type Comment struct {
+	Text string
+	Pos  Position
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,31 @@
+package vm
+
+import (
+	"github.com/titivuk/go-interpreter/code"
+	"github.com/titivuk/go-interpreter/object"
+)
+
+// Frame represents call-relevant information, i.e. the function being executed
+// and where its part of the stack starts
+type Frame struct {
+	cl          *object.Closure
+	ip          int // instruction pointer within the frame's function
+	basePointer int // stack pointer value before the function was called, locals live right above it
+
+	handlers []handler // try blocks of the function that are in progress, the innermost one is the last
+}
+
+// handler is where the frame continues if an instruction fails inside a try block
+type handler struct {
+	ip      int  // position of the catch or finally code
+	sp      int  // stack pointer value when the try block started
+	finally bool // finally gets the error itself, catch gets it as a hash
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,861 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/titivuk/go-interpreter/code"
+	"github.com/titivuk/go-interpreter/compiler"
+	"github.com/titivuk/go-interpreter/object"
+	"github.com/titivuk/go-interpreter/token"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+// reuse some objects, the same way the evaluator does
+var (
+	Null  = object.NULL
+	True  = object.TRUE
+	False = object.FALSE
+)
+
+// operators maps binary opcodes back to the operators of the language,
+// so runtime errors read exactly like the ones produced by the evaluator
+var operators = map[code.Opcode]string{
+	code.OpAdd:          token.PLUS,
+	code.OpSub:          token.MINUS,
+	code.OpMul:          token.ASTERISK,
+	code.OpDiv:          token.SLASH,
+	code.OpEqual:        token.EQ,
+	code.OpNotEqual:     token.NOT_EQ,
+	code.OpGreaterThan:  token.GT,
+	code.OpLessThan:     token.LT,
+	code.OpMod:          token.PERCENT,
+	code.OpGreaterEqual: token.GT_EQ,
+	code.OpLessEqual:    token.LT_EQ,
+	code.OpIn:           token.IN_OPERATOR,
+}
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // always points to the next free slot. Top of stack is stack[sp-1]
+
+	globals     []object.Object
+	globalNames []string
+
+	frames      []*Frame
+	framesIndex int
+}
+
+// RuntimeError is returned by Run when the program fails,
+// it points at the source of the instruction that caused the failure
+type RuntimeError struct {
+	Message string
+	Pos     token.Position
+	Stack   []object.StackFrame // function calls that were in progress, the innermost call first
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+
+	return e.Message
+}
+
+// Traceback is the error message followed by the call stack
+func (e *RuntimeError) Traceback() string {
+	return e.Error() + object.FormatStack(e.Stack)
+}
+
+// exception is the error raised by throw or raised again once finally is done.
+// Unlike other errors of the instructions it carries the thrown value,
+// the error raised again keeps the position and the stack it got when finally caught it
+type exception struct {
+	err *object.Error
+}
+
+func (e exception) Error() string {
+	return e.err.Message
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.Globals,
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// NewWithGlobalsStore creates vm that shares globals with the previous runs,
+// the REPL uses it together with compiler.NewWithState
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// LastPoppedStackElem returns the value of the last expression statement of the program
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) Run() (err error) {
+	defer func() {
+		// a bug in the vm must not crash the program that embeds it
+		if r := recover(); r != nil {
+			err = vm.newRuntimeError(fmt.Errorf("internal error: %v", r))
+		}
+	}()
+
+	err = vm.run(0)
+	if err != nil {
+		return vm.newRuntimeError(err)
+	}
+
+	return nil
+}
+
+func (vm *VM) newRuntimeError(err error) *RuntimeError {
+	// the main frame at index 0 is the program itself, not a function call
+	errObj := vm.errorObject(err, 0)
+	return &RuntimeError{Message: errObj.Message, Pos: errObj.Pos, Stack: errObj.Stack}
+}
+
+// errorObject points the error at the instruction being executed
+// and records functions which were called to get there from the frame at index bottom
+func (vm *VM) errorObject(err error, bottom int) *object.Error {
+	errObj := &object.Error{Message: err.Error()}
+	if e, ok := err.(exception); ok {
+		copied := *e.err
+		errObj = &copied
+	}
+
+	if !errObj.Pos.IsValid() {
+		errObj.Pos = framePosition(vm.currentFrame())
+	}
+
+	stack := append([]object.StackFrame{}, errObj.Stack...)
+	for i := vm.framesIndex - 1; i > bottom; i-- {
+		name := vm.frames[i].cl.Fn.Name
+		if name == "" {
+			name = object.ANONYMOUS_FUNCTION
+		}
+
+		// the caller is still at its OpCall instruction
+		stack = append(stack, object.StackFrame{Function: name, Pos: framePosition(vm.frames[i-1])})
+	}
+	errObj.Stack = stack
+
+	return errObj
+}
+
+// framePosition returns source position of the instruction the frame is executing
+func framePosition(frame *Frame) token.Position {
+	// ip may already point at the operands of the instruction,
+	// so we walk back to the closest offset that starts an instruction
+	for i := frame.ip; i >= 0; i-- {
+		if pos, ok := frame.cl.Fn.Positions[i]; ok {
+			return pos
+		}
+	}
+
+	return token.Position{}
+}
+
+// run executes instructions until the program ends
+// or until the frame at index base returns, the latter is used to call functions from builtins.
+// A failed instruction does not stop it if the frames from base up have a try block in progress
+func (vm *VM) run(base int) error {
+	for {
+		err := vm.execute(base)
+		if err == nil || !vm.catch(err, base) {
+			return err
+		}
+	}
+}
+
+// catch passes the error to the innermost handler of the frames from base up.
+// The frames above the handler are dropped and the stack is restored to the state the try block started with.
+// It reports false if there is no handler
+func (vm *VM) catch(err error, base int) bool {
+	for i := vm.framesIndex - 1; i >= base; i-- {
+		frame := vm.frames[i]
+		if len(frame.handlers) == 0 {
+			continue
+		}
+
+		h := frame.handlers[len(frame.handlers)-1]
+		frame.handlers = frame.handlers[:len(frame.handlers)-1]
+
+		errObj := vm.errorObject(err, i)
+		var caught object.Object = errObj
+		if !h.finally {
+			caught = errObj.Hash()
+		}
+
+		vm.framesIndex = i + 1
+		vm.sp = h.sp
+		frame.ip = h.ip - 1
+
+		return vm.push(caught) == nil
+	}
+
+	return false
+}
+
+// execute runs instructions until the program ends, the frame at index base returns or an instruction fails
+func (vm *VM) execute(base int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex > base && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpPop:
+			vm.pop()
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual, code.OpIn:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+		case code.OpTrue:
+			err := vm.push(True)
+			if err != nil {
+				return err
+			}
+		case code.OpFalse:
+			err := vm.push(False)
+			if err != nil {
+				return err
+			}
+		case code.OpNull:
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+		case code.OpBang:
+			err := vm.executeBangOperator()
+			if err != nil {
+				return err
+			}
+		case code.OpMinus:
+			err := vm.pushResult(object.Negate(vm.pop()))
+			if err != nil {
+				return err
+			}
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			// the loop increments ip, so we set it right before the target
+			vm.currentFrame().ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			// the operand that decides the result of && and || stays on the stack as the result
+			if isTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpTruthyOrPop) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+		case code.OpJumpNotNullOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.stack[vm.sp-1] != Null {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+		case code.OpJumpNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.stack[vm.sp-1] == Null {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			// the global is read before its let statement is executed
+			value := vm.globals[globalIndex]
+			if value == nil {
+				return fmt.Errorf("identifier not found: %s", vm.globalName(int(globalIndex)))
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
+
+			// the variable is captured by a closure, the closure has to see the new value
+			if cell, ok := vm.stack[slot].(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				vm.stack[slot] = vm.pop()
+			}
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			value := vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			// the first capture moves the variable into a cell,
+			// from then on the frame and the closures access it through the cell
+			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
+
+			cell, ok := vm.stack[slot].(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: vm.stack[slot]}
+				vm.stack[slot] = cell
+			}
+
+			err := vm.push(cell)
+			if err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			definition := object.Builtins[builtinIndex]
+			err := vm.push(definition.Builtin)
+			if err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex].Value)
+			if err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			currentClosure.Free[freeIndex].Value = vm.pop()
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure)
+			if err != nil {
+				return err
+			}
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err := vm.push(array)
+			if err != nil {
+				return err
+			}
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+		case code.OpConcat:
+			numValues := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			// values are converted the same way as the str builtin does
+			var out strings.Builder
+			for _, val := range vm.stack[vm.sp-numValues : vm.sp] {
+				out.WriteString(val.Inspect())
+			}
+			vm.sp = vm.sp - numValues
+
+			err := vm.push(&object.String{Value: out.String()})
+			if err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.pushResult(object.Index(left, index))
+			if err != nil {
+				return err
+			}
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			err := vm.pushResult(object.Slice(left, start, end))
+			if err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.pushResult(object.SetIndex(left, index, value))
+			if err != nil {
+				return err
+			}
+		case code.OpDupPair:
+			first := vm.stack[vm.sp-2]
+			second := vm.stack[vm.sp-1]
+
+			err := vm.push(first)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(second)
+			if err != nil {
+				return err
+			}
+		case code.OpIterator:
+			iterable := vm.pop()
+
+			it, ok := object.NewIterator(iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", iterable.Type())
+			}
+
+			err := vm.push(it)
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			numVariables := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			it := vm.pop().(*object.Iterator)
+			if !it.Next() {
+				vm.currentFrame().ip = pos - 1
+				continue
+			}
+
+			values := []object.Object{it.Item()}
+			if numVariables == 2 {
+				values = []object.Object{it.Key(), it.Value()}
+			}
+
+			for _, v := range values {
+				err := vm.push(v)
+				if err != nil {
+					return err
+				}
+			}
+		case code.OpSetupTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			finally := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			frame := vm.currentFrame()
+			frame.handlers = append(frame.handlers, handler{ip: pos, sp: vm.sp, finally: finally})
+		case code.OpPopTry:
+			frame := vm.currentFrame()
+			frame.handlers = frame.handlers[:len(frame.handlers)-1]
+		case code.OpThrow:
+			return exception{object.NewThrownError(vm.pop())}
+		case code.OpRethrow:
+			return exception{vm.pop().(*object.Error)}
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// `return` outside of a function stops the program,
+			// the returned value becomes the last popped element
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			frame := vm.popFrame()
+			// -1 to get rid of the closure that has been called as well
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+		case code.OpQuote:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numValues := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().ip += 4
+
+			values := append([]object.Object{}, vm.stack[vm.sp-numValues:vm.sp]...)
+			vm.sp = vm.sp - numValues
+
+			node, errObj := object.Unquote(vm.constants[constIndex].(*object.Quote).Node, values)
+			if errObj != nil {
+				return exception{errObj}
+			}
+
+			err := vm.push(&object.Quote{Node: node})
+			if err != nil {
+				return err
+			}
+		case code.OpError:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			return fmt.Errorf("%s", vm.constants[constIndex].Inspect())
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+
+			return fmt.Errorf("unsupported opcode %s", def.Name)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+
+	return ""
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	return vm.pushResult(object.BinaryOperation(left, operators[op], right))
+}
+
+// pushResult pushes the result of an operation implemented in the object package,
+// an *object.Error becomes the runtime error, the same as the evaluator reports it
+func (vm *VM) pushResult(result object.Object) error {
+	if errObj, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
+	}
+
+	if result == nil {
+		return vm.push(Null)
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case False:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := object.NewHash()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	// the callee sits right below the arguments
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	// arguments are already on the stack, so they become the first locals of the frame
+	frame := NewFrame(cl, vm.sp-numArgs)
+	err := vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	// reserve space for the rest of the locals.
+	// The slots may still hold cells of an earlier call, they must not be shared with this one
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(vm.callFunction, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	// errors returned by builtins abort the program, the same as in the evaluator.
+	// The error may come from a callback, e.g. a value thrown by it
+	if errObj, ok := result.(*object.Error); ok {
+		return exception{errObj}
+	}
+
+	if result != nil {
+		return vm.push(result)
+	}
+
+	return vm.push(Null)
+}
+
+// callFunction calls a closure or a builtin on behalf of a builtin and returns the result.
+// The closure is executed right away, the same as if OpCall was followed by its instructions.
+// The frames of a failed call are left in place, so the error points into the callback
+func (vm *VM) callFunction(fn object.Object, args ...object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *object.Closure:
+		base := vm.framesIndex
+
+		err := vm.push(fn)
+		for i := 0; err == nil && i < len(args); i++ {
+			err = vm.push(args[i])
+		}
+		if err == nil {
+			err = vm.callClosure(fn, len(args))
+		}
+		if err == nil {
+			err = vm.run(base)
+		}
+		if e, ok := err.(exception); ok {
+			return e.err
+		}
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+
+		return vm.pop()
+	case *object.Builtin:
+		if result := fn.Fn(vm.callFunction, args...); result != nil {
+			return result
+		}
+
+		return Null
+	default:
+		return &object.Error{Message: fmt.Sprintf("not a function: %s", fn.Type())}
+	}
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]*object.Cell, numFree)
+	for i := 0; i < numFree; i++ {
+		value := vm.stack[vm.sp-numFree+i]
+
+		// everything but the function that captures itself comes in a cell already
+		cell, ok := value.(*object.Cell)
+		if !ok {
+			cell = &object.Cell{Value: value}
+		}
+		free[i] = cell
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,912 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/titivuk/go-interpreter/ast"
+	"github.com/titivuk/go-interpreter/code"
+	"github.com/titivuk/go-interpreter/compiler"
+	"github.com/titivuk/go-interpreter/evaluator"
+	"github.com/titivuk/go-interpreter/lexer"
+	"github.com/titivuk/go-interpreter/object"
+	"github.com/titivuk/go-interpreter/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"-1.5", -1.5},
+		{"1.5 + 1", 2.5},
+		{"10 / 4.0", 2.5},
+		{"2 * 0.25", 0.5},
+		{"1 < 1.5", true},
+		{"2.0 == 2", true},
+		{"float(3) / 2", 1.5},
+		{"int(7.9)", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"3037000500 * 3037000500", "9223372037000250000"},
+		{"-(-9223372036854775808)", "9223372036854775808"},
+		{"123456789012345678901234567890 - 123456789012345678901234567890", "0"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong result. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"!true", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", false},
+		{"1 <= 2", true},
+		{"2 >= 3", false},
+		{"1.5 >= 1", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"1 < 2 && 2 <= 2 && 3 >= 3", true},
+		{"false && 1 + true", false},
+		{"true || 1 + true", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		// branches without a value leave null on the stack
+		{"if (true) { let a = 1; }", Null},
+		{"if (true) {}", Null},
+		{"if (false) { 1 } else {}", Null},
+		{"let x = if (true) {}; x", Null},
+		{"let f = fn() { if (true) { let a = 1; } }; f()", Null},
+		{"let i = 0; if (true) { while (i < 3) { i += 1; } }", Null},
+		{"let i = 0; let x = if (true) { while (i < 3) { i += 1; } }; [x, i][1]", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"1 && 2", 2},
+		{"1 || 2", 1},
+		{"[][0] || 2", 2},
+		{"false || [][0]", Null},
+		{"let x = false || 5; x", 5},
+		{"let n = 0; let f = fn() { n += 1; true }; false && f(); true || f(); n", 0},
+		{"let n = 0; let f = fn() { n += 1; true }; true && f(); false || f(); n", 2},
+		{"let f = fn(a, b) { a && b || 10 }; [f(1, 2), f(1, [][0]), f(false, 2)]", []int{2, 10, 10}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true ? 1 : 2", 1},
+		{"[][0] ? 1 : 2", 2},
+		{"let sign = fn(n) { n < 0 ? -1 : n == 0 ? 0 : 1 }; [sign(-5), sign(0), sign(5)]", []int{-1, 0, 1}},
+		{"false ? 1 + true : 2", 2},
+		{"[][0] ?? 5", 5},
+		{"false ?? 5", false},
+		{"let n = 0; let f = fn() { n += 1 }; 1 ?? f(); [][0] ?? f(); n", 1},
+		{`let h = {"a": {"b": 5}}; h?.a?.b`, 5},
+		{`let h = {"a": {"b": 5}}; h?.["a"]?.["b"]`, 5},
+		{`let h = {"a": {"b": 5}}; h?.x?.b`, Null},
+		{`let h = {"a": {"b": 5}}; h?.x?.b ?? 0`, 0},
+		{`let f = fn(h) { h?.a?.[1] }; f({"a": [1, 2]})`, 2},
+		{`let f = fn(h) { h?.a?.[1] }; f({})`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4, 5][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4, 5][-2:]", []int{4, 5}},
+		{"[1, 2, 3, 4, 5][:-2]", []int{1, 2, 3}},
+		{"[1, 2, 3][:]", []int{1, 2, 3}},
+		{"[1, 2, 3][2:1]", []int{}},
+		{"[1, 2, 3][-100:100]", []int{1, 2, 3}},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-4]", Null},
+		{`"héllo"[-1]`, "o"},
+		{`"héllo"[1:-1]`, "éll"},
+		{"let f = fn(a, n) { a[n:] }; f([1, 2, 3], 1)", []int{2, 3}},
+		{"let a = [1, 2, 3]; let b = a[:]; b[0] = 10; a", []int{1, 2, 3}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"abc" < "abd"`, true},
+		{`"b" > "abc"`, true},
+		{`"ab" <= "ab"`, true},
+		{`"ab" >= "b"`, false},
+		{`"ell" in "hello"`, true},
+		{`"lo!" in "hello"`, false},
+		{`"ab" * 3`, "ababab"},
+		{`2 * "é"`, "éé"},
+		{`let name = "Monkey"; "hello ${name}!"`, "hello Monkey!"},
+		{`let f = fn(x) { "<${x}>" }; f(1) + f([2])`, "<1><[2]>"},
+		{`let x = 1; "outer ${"inner ${x + 1}"}"`, "outer inner 2"},
+		{`"\${x}"`, "${x}"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3] == [1, 2, 3]", true},
+		{"[1, 2, 3] != [1, 2, 3]", false},
+		{"[1, 2] == [2, 1]", false},
+		{`[1, "a", true] == [1.0, "a", true]`, true},
+		{"[[1, [2]], [3]] == [[1, [4]], [3]]", false},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} != {"b": 1}`, true},
+		{"let f = fn(a) { a[1:] }; f([1, 2, 3]) == [2, 3]", true},
+		{"let a = [1]; a[0] = a; a == a", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCollectionHashKeys(t *testing.T) {
+	tests := []vmTestCase{
+		{`{[1, 2]: "x"}[[1, 2]]`, "x"},
+		{`{[1, 2]: "x"}[[2, 1]]`, Null},
+		{`{[1]: "x"}[[1.0]]`, "x"},
+		{`{{"a": 1, "b": [2]}: "x"}[{"b": [2], "a": 1}]`, "x"},
+		{`let h = {}; h[[1, [2]]] = 1; h[[1, [2]]] += 1; h[[1, [2]]]`, 2},
+		{`let k = [1]; let h = {k: 5}; k[0] = 2; [h[[1]], h[k] ?? 0]`, []int{5, 0}},
+		{"let calls = 0; let memo = {}; let add = fn(a, b) { memo[[a, b]] ?? (memo[[a, b]] = calls += 1) }; add(1, 2); add(2, 1); add(1, 2); calls", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[5]`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayAndHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][99]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{}[0]", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+let newAdder = fn(a, b) {
+  let c = a + b;
+  fn(d) { c + d };
+};
+let adder = newAdder(1, 2);
+adder(8);`,
+			11,
+		},
+		{
+			`
+let wrapper = fn() {
+  let countDown = fn(x) {
+    if (x == 0) {
+      return 0;
+    } else {
+      countDown(x - 1);
+    }
+  };
+  countDown(1);
+};
+wrapper();`,
+			0,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFibonacci(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+let fibonacci = fn(x) {
+  if (x == 0) {
+    return 0;
+  } else {
+    if (x == 1) {
+      return 1;
+    } else {
+      fibonacci(x - 1) + fibonacci(x - 2);
+    }
+  }
+};
+fibonacci(15);`,
+			610,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let a = 1; let b = 2; a = b = 5; a + b", 10},
+		{"let x = 10; x -= 3; x *= 4; x /= 2; x", 14},
+		{"let f = fn(x) { x += 1; x }; f(41)", 42},
+		{"let x = 1; let f = fn() { x = 10 }; f(); x", 10},
+		{"let i = 0; let s = 0; while (i < 4) { s += i; i += 1; }; s", 6},
+		{"let a = [1, 2, 3]; a[1] = 20; a[1] += 5; a", []int{1, 25, 3}},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] += 10; h["a"] + h["b"]`, 13},
+		{"let a = [1]; let b = a; b[0] = 5; a[0]", 5},
+		// closures share captured variables with the function that defines them
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let a = counter(); let b = counter(); a(); a(); b()", 1},
+		{"let f = fn() { let n = 1; let inc = fn() { n = n * 10 }; inc(); inc(); n }; f()", 100},
+		{"let f = fn() { let n = 1; let get = fn() { n }; n = 5; get() }; f()", 5},
+		{"let f = fn(n) { let g = fn() { fn() { n += 1 } }; let h = g(); h(); h(); n }; f(0)", 2},
+		{"let f = fn() { let s = 0; for (x in [1, 2, 3]) { let add = fn() { s += x }; add(); }; s }; f()", 6},
+		{"let a = [1, 2, 3]; a[-1] = 30; a[-3] += 10; a", []int{11, 2, 30}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConst(t *testing.T) {
+	tests := []vmTestCase{
+		{"const x = 5; x * 2", 10},
+		{"const x = 5; let f = fn() { let x = 1; x = 2; x }; f()", 2},
+		{"const a = [1]; a[0] = 2; a[0]", 2},
+		{"let f = fn() { let n = 0; for (x in [1, 2, 3]) { const y = x * 2; n += y; }; n }; f()", 12},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x; } } }; f([1, 2, 3, 4])", 3},
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x; } } }; f([1])", Null},
+		{"let f = fn() { while (true) { return 5; } }; f()", 5},
+		{"while (false) { 1 }; 2", 2},
+		{"for (x in [1, 2, 3]) { if (x == 2) { break; } }; x", 2},
+		{"let last = 0; for (x in [1, 2, 3, 4]) { if (x > 2) { continue; } let last = x; }; last", 2},
+		{`for (i, ch in "héllo") { }; i`, 4},
+		{`let f = fn() { for (k, v in {"b": 2, "a": 1}) { return [k, v]; } }; f()[1]`, 2},
+		{"let f = fn() { for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { break; } } }; x + y }; f()", 22},
+		{"let i = 0; while (i < 3) { i += 1; }; i", 3},
+		{"for (x in [1, 2]) { x; }; x", 2},
+		// continue inside of an if statement leaves nothing behind on the stack
+		{"let n = 0; for (i in range(3000)) { if (true) { continue; } }; n", 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("four")`, 4},
+		{`len("héllo")`, 5},
+		{`len([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []int{1}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`first([1, 2])`, 1},
+		{`last([])`, Null},
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map(["a", "bc"], len)`, []int{1, 2}},
+		{`filter(range(10), fn(x) { x % 3 == 0 })`, []int{0, 3, 6, 9}},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x }, 10)`, 16},
+		{`reduce(["a", "b", "c"], fn(acc, x) { x + acc })`, "cba"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
+		{`reverse(sort([2, 3, 1]))`, []int{3, 2, 1}},
+		{`flatten(zip([1, 2], [3, 4]))`, []int{1, 3, 2, 4}},
+		{`unique([1, 2, 1, 3, 2])`, []int{1, 2, 3}},
+		{`index_of([1, 2, 3], 3)`, 2},
+		{`contains({[1]: 1}, [1])`, true},
+		// closures called by builtins can capture and assign variables
+		{`let f = fn() { let sum = 0; map([1, 2, 3], fn(x) { sum += x }); sum }; f()`, 6},
+		{`let add = fn(n) { fn(x) { x + n } }; map([1, 2], add(10))`, []int{11, 12}},
+		{`let f = fn(xs) { map(xs, fn(x) { return x + 1; 0 }) }; f([1])`, []int{2}},
+		{`map([[1, 2], [3]], fn(xs) { reduce(xs, fn(a, b) { a + b }) })`, []int{3, 3}},
+		{`let fact = fn(n) { reduce(range(1, n + 1), fn(a, b) { a * b }, 1) }; map(range(5), fact)`, []int{1, 1, 2, 6, 24}},
+		// the vm keeps running the caller after the callback returns
+		{`let xs = map([1, 2], fn(x) { x }); let ys = [3]; len(xs) + len(ys)`, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: unknown operator: -BOOLEAN"},
+		{"true < false", "1:6: unknown operator: BOOLEAN < BOOLEAN"},
+		{`"Hello" - "World"`, "1:9: unknown operator: STRING - STRING"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "1:19: unusable as hash key: CLOSURE"},
+		{`len(1)`, "1:4: argument to `len` not supported, got INTEGER"},
+		{`1()`, "1:2: not a function: INTEGER"},
+		{"fn() { 1; }(1);", "1:12: wrong number of arguments: want=0, got=1"},
+		{"let f = fn() {\n  1 + true;\n};\nf();", "2:5: type mismatch: INTEGER + BOOLEAN"},
+		{"1 / 0", "1:3: division by zero"},
+		{"99999999999999999999 / (1 - 1)", "1:22: division by zero"},
+		{"len()", "1:4: wrong number of arguments. got=0, want=1"},
+		{"for (x in 5) { x }", "1:1: cannot iterate over INTEGER"},
+		{"let a = [1]; a[5] = 1", "1:19: index out of range: 5"},
+		{`let s = "ab"; s[0] = "c"`, "1:20: index assignment not supported: STRING[INTEGER]"},
+		{"let x = 1; x += true", "1:14: type mismatch: INTEGER + BOOLEAN"},
+		{"x = 1", "1:3: identifier not found: x"},
+		{"len = 1", "1:5: cannot assign to builtin len"},
+		{"const f = fn() { f = 1 }; f()", "1:20: cannot assign to constant f"},
+		{"const x = 1; x = 2", "1:16: cannot assign to constant x"},
+		{"const x = 1; fn() { x += 2 }()", "1:23: cannot assign to constant x"},
+		{"const x = 1; let x = 2", "1:14: cannot redeclare constant x"},
+		{"fn() { const x = 1; const x = 2 }()", "1:21: cannot redeclare constant x"},
+		{"const x = 1; for (x in []) { }", "1:14: cannot redeclare constant x"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Errorf("expected vm error for %q", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong vm error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+// TestTracebackParity expects both backends to report the same call stack
+func TestTracebackParity(t *testing.T) {
+	tests := []string{
+		"1 + true",
+		"let f = fn() { 1 + true }; f()",
+		"let inner = fn(x) { x / 0 };\nlet outer = fn(x) { inner(x) + 1 };\nouter(1);",
+		"fn() { -true }()",
+		"let f = fn(g) { g() }; f(fn() { len(1) })",
+		"let f = fn(x) { x }; f()",
+		"let f = fn(n) { if (n == 0) { 1 / 0 } else { f(n - 1) } }; f(30)",
+		"let adder = fn(x) { fn(y) { x + y } }; let add = adder(1); add(true)",
+		"let double = fn(x) { x * 2 };\nmap([1, true], double)",
+		"let f = fn(xs) { sort(xs, fn(a, b) { a < true }) }; f([2, 1])",
+		"map([1], fn(a, b) { a })",
+		"let f = fn(x) { map([x], fn(y) { filter([y], fn(z) { z / 0 }) }) }; f(1)",
+	}
+
+	for _, input := range tests {
+		program := parse(input)
+
+		evaluated, ok := evaluator.Eval(program, object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Fatalf("%q: evaluator did not fail", input)
+		}
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("%q: vm did not fail with RuntimeError. got=%v", input, err)
+		}
+
+		if evaluated.Traceback() != "ERROR: "+runtimeErr.Traceback() {
+			t.Errorf("backends disagree on %q.\nevaluator=%q\nvm       =%q",
+				input, evaluated.Traceback(), "ERROR: "+runtimeErr.Traceback())
+		}
+	}
+}
+
+func TestPanicsBecomeErrors(t *testing.T) {
+	// the constant does not exist, so the vm indexes past the constants pool
+	bytecode := &compiler.Bytecode{
+		Instructions: code.Make(code.OpConstant, 5),
+		Constants:    []object.Object{},
+	}
+
+	vm := New(bytecode)
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected vm error")
+	}
+
+	if !strings.HasPrefix(err.Error(), "internal error: ") {
+		t.Errorf("wrong vm error. got=%q", err.Error())
+	}
+}
+
+// TestBackendParity runs the same programs through the evaluator and the vm
+// and expects both of them to produce the same output
+func TestBackendParity(t *testing.T) {
+	tests := []string{
+		"5 * (2 + 10) - 3",
+		"let f = fn(a, b) { a / b }; f(1, 0)",
+		"let f = fn(a, b) { a / b }; f(1)",
+		"[1.5 + 2, 7 / 2, 7 / 2.0, -0.5 * 3, 2.0, 1 == 1.0, 0.1 + 0.2]",
+		"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; [f(25), f(25) / f(24), -9223372036854775808 / -1, 99999999999999999999 > 1]",
+		`{99999999999999999999: "big"}[99999999999999999998 + 1]`,
+		`[int(2.5), float(2), str(1.5), int("x"), 1.5 + true]`,
+		"let a = 5; let b = a * 2; [a, b, a + b]",
+		`let s = "mon"; s + "key"`,
+		`let a = [1]; a[0] = a; let h = {}; h["h"] = h; [a, h]`,
+		// a function that assigns to its own name changes the binding it is stored in
+		"let f = fn() { f = 1 }; f(); f",
+		"let f = fn() { f = 1; f }; f()",
+		"let g = fn() { let f = fn(n) { if (n > 0) { f(n - 1) } else { f = n } }; f(2); f }; g()",
+		"let f = fn() { let g = fn() { f = 2 }; g() }; [f(), f]",
+		"let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(3)",
+		"const f = fn() { f = 1 }; f()",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (false) { 10 }",
+		"if (true) { let a = 1; }",
+		"let x = if (true) {}; [x, if (false) { 1 } else { let b = 2; }]",
+		"let i = 0; [if (true) { while (i < 3) { i += 1; } }, i]",
+		"!true",
+		"!!5",
+		"return 10; 9;",
+		"if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+		"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+		"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3);",
+		`
+let fibonacci = fn(x) {
+  if (x < 2) { return x; }
+  fibonacci(x - 1) + fibonacci(x - 2);
+};
+fibonacci(20);`,
+		`
+let map = fn(arr, f) {
+  let iter = fn(arr, accumulated) {
+    if (len(arr) == 0) {
+      accumulated
+    } else {
+      iter(rest(arr), push(accumulated, f(arr[0])));
+    }
+  };
+  iter(arr, []);
+};
+map([1, 2, 3, 4], fn(x) { x * 2 });`,
+		`{"one": 1}["one"]`,
+		`let 名前 = "héllo"; [len(名前), 名前[1], 名前[9]]`,
+		`{"one": 1}["two"]`,
+		"[1, 2, 3][3]",
+		"5 + true; 5;",
+		"true + false",
+		`"Hello" - "World"`,
+		`len(1)`,
+		`{"name": "Monkey"}[[]];`,
+		"let f = fn(x) {\n  x + true\n};\nf(1);",
+		"let f = fn(xs) { for (i, x in xs) { if (x == 3) { return i; } } }; [f([1, 2, 3]), f([])]",
+		`let f = fn(h) { for (k, v in h) { if (v > 1) { return k; } } }; f({"a": 1, "b": 2, "c": 3})`,
+		"let f = fn() { while (true) { for (x in [1, 2]) { if (x == 2) { break; } }; return x; } }; f()",
+		"for (x in [1, 2, 3]) { if (x < 3) { continue; } x + true }",
+		"for (x in 5) { x }",
+		"let f = fn() { for (x in []) { } }; f()",
+		"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); [c(), c(), c()]",
+		"let make = fn() { let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }) }; fs }; let fs = make(); [fs[0](), fs[1]()]",
+		`let h = {"a": 1}; h["a"] -= 3; h["b"] = [0]; h["b"][0] += 2; [h["a"], h["b"]]`,
+		"let a = [1]; a[1] = 2",
+		`let h = {}; h[[]] = 1`,
+		"x = 1",
+		"len = 1",
+		"const x = 5; let f = fn() { x = 6 }; f()",
+		"const x = 5; let x = 6",
+		"const x = 5; let f = fn() { const x = 6; x }; f()",
+		"const x = 1; if (false) { x = 2 }; x",
+		"const x = 1; if (false) { let x = 2 }; x",
+		"const x = 1; if (false) { for (x in [2]) { } }; x",
+		"if (false) { len = 1 }; len([1])",
+		"let i = 0; while (i < 2) { const c = i; i += 1 }; c",
+		"const x = 1; try { x = 2 } catch (e) { [e, x] }",
+		`let x = 1; x /= 0`,
+		"[7 % 3, -7 % 3, 7.5 % 2, 99999999999999999999 % 7, 1 <= 1, 2 >= 3, 1 <= 1.5, 99999999999999999999 >= 1]",
+		"[1 && 2, [][0] && 2, 0 || 3, false || [][0], true && false || 5]",
+		"let n = 0; let f = fn() { n += 1 }; [false && f(), true || f(), n]",
+		"7 % 0",
+		"99999999999999999999 % 0",
+		`"a" <= "b"`,
+		"true && 1 + true",
+		"[true ? 1 : 2, false ? 1 : 2, 1 > 2 ? 1 : 2 > 1 ? 3 : 4, [][0] ?? 5, false ?? 5, 1 ?? 1 + true]",
+		`let h = {"a": {"b": [5]}}; [h?.a?.b?.[0], h?.x?.b, h?.["x"]?.[1 + true], h?.a?.c ?? "none"]`,
+		`let h = {"a": 1}; h["x"]["b"]`,
+		"1?.x",
+		"1 + true ? 1 : 2",
+		`[[1, 2, 3][1:], [1, 2, 3][:-1], [1, 2, 3][-2:-1], [1, 2, 3][5:], "héllo"[-3:], "héllo"[:2], [1, 2, 3][-1], "héllo"[-5], [1][-2]]`,
+		`[1, 2, 3]["a":]`,
+		"5[1:2]",
+		"let a = [1]; a[-2] = 0",
+		"let a = [1, 2]; a[-1] += 5; a",
+		`["a" == "a", "a" != "b", "abc" < "abd", "b" > "abc", "" <= "", "é" >= "z", "ell" in "hello", "x" in ""]`,
+		`["ab" * 3, 2 * "é", "ab" * 0]`,
+		`"ab" * -1`,
+		`"ab" * 99999999999`,
+		`"a" * "b"`,
+		`1 in "abc"`,
+		`let xs = [1, "a", 1.5, true, [][0], {"k": [2]}]; "${xs} ${len(xs)} ${xs[0] + 1}"`,
+		`"${1 + true}"`,
+		`[[] == [], [1, [2, {"a": [3]}]] == [1, [2, {"a": [3]}]], [1, 2] != [1, 2.5], {"a": 1} == {"a": 1, "b": 2}, [[][0]] == [[][0]]]`,
+		"let f = fn() {}; [[f] == [f], [fn() {}] == [fn() {}], (1 < 2) == true, [1 < 2] == [true]]",
+		"[1] == {}",
+		"[1] < [2]",
+		`let h = {[1, "a"]: 1, {"k": [2]}: 2}; h[[1.0, "a"]] + h[{"k": [2]}]`,
+		`let k = [1]; let h = {k: 5}; k[0] = 2; [h[[1]], h[k], h]`,
+		`{[fn() {}]: 1}[[fn() {}]]`,
+		`{"b": 1, "a": 2, 3: [1], true: {"z": 0, "y": 1}}`,
+		`let h = {"z": 1}; h["a"] = 2; h["z"] = 3; [h, "${h}", str(h)]`,
+		`let s = ""; let f = fn(x) { s = s + x; x }; [{f("c"): f("1"), f("a"): f("2")}, s]`,
+		`let s = ""; for (k, v in {"c": 1, "a": 2, "b": 3}) { s = s + k + str(v) }; s`,
+		`[first([1, 2]), last([1, 2]), first([]), last([])]`,
+		`map([1, 2.5, "a", [1]], fn(x) { x + x })`,
+		`filter([1, [][0], false, 0, "", []], fn(x) { x })`,
+		`reduce([], fn(acc, x) { acc + x })`,
+		`[sort([3, 1.5, 2, 99999999999999999999, -1]), sort(["b", "c", "a"]), sort([])]`,
+		`sort([[2, "b"], [1, "a"], [2, "a"]], fn(a, b) { a[0] < b[0] })`,
+		`[reverse([1, 2, 3]), reverse("héllo"), contains("hello", "ell"), index_of("héllo", "l")]`,
+		`[zip([1, 2, 3], ["a", "b"]), range(10, 0, -4), flatten([1, [2, [3]]]), unique([1, 1.0, [1], [1]])]`,
+		`let h = {}; map(range(3), fn(i) { h[[i, i * i]] = i }); h`,
+		`map([fn(x) { x + 1 }, len], fn(f) { f("a") })`,
+		`map([1], fn(x) { x + true })`,
+		`map([1], 1)`,
+		`sort([1, "a"])`,
+		`sort([[1], [2]])`,
+		`reduce([1])`,
+		`range(0, 5, 0)`,
+		`let h = {1.0: "a", 0.5: "b", 9223372036854775807: "c"}; h[1] = "d"; [h, h[9223372036854775808.0], h[0.5]]`,
+		`[range(9223372036854775806, 9223372036854775807, 2), range(0, -9223372036854775807, -9223372036854775807 - 1)]`,
+		`range(0, 9223372036854775807)`,
+		`zip()`,
+		`contains("abc", 1)`,
+		`first(1)`,
+		`[if (contains([1], 2)) { 1 } else { 2 }, !contains("a", "b"), contains({}, 1) || 3, contains([1], 1) == true]`,
+		// names are resolved when the code runs
+		"let f = fn(){ g() }; let g = fn(){ 1 }; f()",
+		"let f = fn(){ g() }; f(); let g = fn(){ 1 }",
+		"if (false) { undefinedName }; 1",
+		"if (true) { undefinedName }",
+		"let f = fn() { undefinedName }; [1, f()]",
+		"let f = fn() { n += 1 }; let n = 1; f(); f(); n",
+		"let f = fn() { n = 5 }; f()",
+		"for (x in []) { }; x",
+		"if (false) { let a = 1 }; a",
+		"let f = fn() { x }; let g = fn() { let x = 2; f() }; g()",
+		"unquote(1)",
+		// quote and macro literals that are not expanded before the code runs
+		"quote(1 + 2)",
+		"let x = 8; [quote(unquote(x) + unquote(x * 2)), quote(f(unquote(x > 1)))]",
+		"let x = 8; let f = fn(y) { quote(unquote(x) + unquote(y)) }; [f(1), f(2.5), f(\"a\"), f(quote(z))]",
+		"quote(1, 2)",
+		"quote(unquote(1, 2))",
+		"quote(unquote([1]))",
+		"quote(unquote(x))",
+		"quote(unquote(1 + true))",
+		"let n = 0; let inc = fn() { n += 1; n }; [quote(unquote(inc()) + unquote(inc())), n]",
+		"let m = fn() { macro(x) { x } }; 1",
+		"let m = fn() { macro(x) { x } }; m()",
+		"[1, macro(x) { x }]",
+		`throw "boom"`,
+		`1; throw 40 + 2; 3`,
+		`throw {"message": "not found", "code": 404}`,
+		`let f = fn() { throw [1, 2] }; f()`,
+		`throw 1 + true`,
+		`[try { 1 } catch (e) { 2 }, try { throw "boom"; 1 } catch (e) { 2 }, try { 1 / 0 } catch (e) { e }]`,
+		`try { len(1) } catch (e) { e }`,
+		`try { throw {"code": 7} } catch (e) { [e["value"]["code"], e] }`,
+		"try {\n  1 + true\n} catch (e) { e }",
+		"let inner = fn() { throw \"boom\" };\nlet outer = fn() { inner() };\ntry { outer() } catch (e) { e }",
+		"let inner = fn() { throw \"boom\" };\nlet outer = fn() { try { inner() } catch (e) { e[\"stack\"] } };\nouter()",
+		`try { throw "boom" } catch (e) { 1 }; e`,
+		`let e = 1; try { throw "boom" } catch (e) { let x = 2; e }; [e, x]`,
+		`let e = 1; try { throw "boom" } catch (e) { e = 2 }; e`,
+		// nested try and rethrow
+		`try { try { throw "inner" } catch (e) { throw e } } catch (e) { e }`,
+		`try { try { throw "inner" } catch (e) { throw "outer" } } catch (e) { e["message"] }`,
+		`try { throw "a" } catch (e) { throw "b" }`,
+		`try { try { 1 + true } finally { 2 } } catch (e) { e }`,
+		`let f = fn() { try { throw "x" } finally { 1 } }; try { f() } catch (e) { e }`,
+		`try { try { 1 } catch (e) { 2 }; 1 + true } catch (e) { e["message"] }`,
+		`let f = fn(n) { if (n == 0) { throw "bottom" } try { f(n - 1) } catch (e) { throw n } }; try { f(3) } catch (e) { e }`,
+		`let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()`,
+		`let f = fn() { try { throw "x" } catch (e) { return 2; }; 3 }; f()`,
+		`let f = fn() { let v = try { throw "x" } catch (e) { 5 }; v * 2 }; f()`,
+		`let f = fn() { try { return 1; } catch (e) { 2 } }; [f(), 1 + true]`,
+		// finally
+		`let r = try { 1 } finally { 2 }; r`,
+		`try { throw "boom" } catch (e) { 2 } finally { 3 }`,
+		`try { throw "boom" } finally { 3 }`,
+		`try { 1 } finally { throw "finally" }`,
+		`let f = fn() { try { return 1; } finally { return 2; } }; f()`,
+		`let f = fn() { try { throw "x" } finally { return 2; } }; f()`,
+		`let f = fn() { try { let a = 5; throw "x" } catch (e) { 1 } finally { return a; } }; f()`,
+		`let log = []; let f = fn() { try { try { return 1 } finally { log = push(log, "inner") } } finally { log = push(log, "outer") } }; [f(), log]`,
+		`let log = []; let f = fn() { try { throw "x" } catch (e) { return 2 } finally { log = push(log, "f") } }; [f(), log]`,
+		`let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break; } } finally { let n = n + 1; } }; n`,
+		`let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { continue; } } finally { n += 10 }; n += 1 }; n`,
+		`let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break; } } catch (e) { 0 }; n += 1 }; try { 1 + true } catch (e) { [n, e["message"]] }`,
+		`let r = []; for (x in [1, 2]) { try { for (y in [1, 2]) { break; }; 1 + true } catch (e) { r = push(r, e) } }; r`,
+		`try { for (x in [1]) { throw "boom" } } catch (e) { e["message"] }`,
+		`let f = fn() { try { 1 + true } catch (e) { [e] } }; [f(), f()]`,
+		// errors of callbacks called by builtins
+		`try { map([1, 2], fn(x) { if (x == 2) { throw x } x }) } catch (e) { e }`,
+		`map([1, 2], fn(x) { try { throw x } catch (e) { e["value"] * 10 } })`,
+		`try { sort([3, 1], fn(a, b) { a + true }) } catch (e) { e }`,
+	}
+
+	for _, input := range tests {
+		evaluated := runEvaluator(input)
+		executed := runVm(input)
+
+		if evaluated != executed {
+			t.Errorf("backends disagree on %q.\nevaluator=%q\nvm       =%q",
+				input, evaluated, executed)
+		}
+	}
+}
+
+func TestCallDepthParity(t *testing.T) {
+	// the frame of the program itself does not count as a call
+	if evaluator.MaxCallDepth != MaxFrames-1 {
+		t.Errorf("backends allow different call depth. evaluator=%d, vm=%d", evaluator.MaxCallDepth, MaxFrames-1)
+	}
+}
+
+func runEvaluator(input string) string {
+	result := evaluator.Eval(parse(input), object.NewEnvironment())
+	if result == nil {
+		return ""
+	}
+
+	return result.Inspect()
+}
+
+func runVm(input string) string {
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		return "ERROR: " + err.Error()
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		return "ERROR: " + err.Error()
+	}
+
+	return vm.LastPoppedStackElem().Inspect()
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.input, tt.expected, stackElem)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		err := testIntegerObject(int64(expected), actual)
+		if err != nil {
+			t.Errorf("%q: testIntegerObject failed: %s", input, err)
+		}
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok {
+			t.Errorf("%q: object is not Float. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value != expected {
+			t.Errorf("%q: object has wrong value. got=%g, want=%g", input, result.Value, expected)
+		}
+	case bool:
+		err := testBooleanObject(expected, actual)
+		if err != nil {
+			t.Errorf("%q: testBooleanObject failed: %s", input, err)
+		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok {
+			t.Errorf("%q: object is not String. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if str.Value != expected {
+			t.Errorf("%q: object has wrong value. got=%q, want=%q", input, str.Value, expected)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("%q: object not Array: %T (%+v)", input, actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("%q: wrong num of elements. want=%d, got=%d",
+				input, len(expected), len(array.Elements))
+			return
+		}
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("%q: testIntegerObject failed: %s", input, err)
+			}
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%q: object is not Null: %T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+
+	return nil
+}